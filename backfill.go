@@ -0,0 +1,227 @@
+package cloudwatch
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// DockerClient is the subset of the Docker API used to backfill logs.
+type DockerClient interface {
+	ListContainers(opts docker.ListContainersOptions) ([]docker.APIContainers, error)
+	InspectContainer(id string) (*docker.Container, error)
+	Logs(opts docker.LogsOptions) error
+}
+
+// backfill merges logs that containers wrote while logspout was down into
+// the live message stream.
+func backfill(in <-chan *router.Message, backfiller *Backfiller) <-chan *router.Message {
+	if backfiller == nil {
+		return in
+	}
+
+	out := make(chan *router.Message)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		backfiller.Start(out)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for msg := range in {
+			if backfiller.Live(msg) {
+				out <- msg
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// Backfiller reads the logs that running containers wrote between their
+// checkpoint and the time the adapter started from the Docker logs API.
+// Containers without a checkpoint, such as those started while logspout was
+// down, are read from the later of their start and the last save of the state
+// file, and are not backfilled at all without a state file. Logs older than
+// CloudWatch accepts are never read. Live
+// messages before the adapter started are dropped for backfilled containers,
+// so each log is shipped once even when logspout replays a container's
+// backlog.
+type Backfiller struct {
+	client     DockerClient
+	checkpoint *Checkpoint
+	started    time.Time
+	saved      time.Time
+	since      map[string]time.Time
+	backfilled map[string]bool
+
+	// ready is closed once the containers to backfill are known.
+	ready chan struct{}
+}
+
+// NewBackfiller instantiates a Backfiller for the containers in a
+// checkpoint.
+func NewBackfiller(client DockerClient, checkpoint *Checkpoint, started time.Time) *Backfiller {
+	return &Backfiller{
+		client:     client,
+		checkpoint: checkpoint,
+		started:    started,
+		saved:      checkpoint.Saved(),
+		since:      checkpoint.Snapshot(),
+		backfilled: map[string]bool{},
+		ready:      make(chan struct{}),
+	}
+}
+
+// Live reports whether a message from the live stream should be shipped. It
+// waits until Start has listed the containers to backfill.
+func (b *Backfiller) Live(msg *router.Message) bool {
+	if msg.Container == nil {
+		return true
+	}
+
+	<-b.ready
+
+	if !b.backfilled[msg.Container.ID] {
+		return true
+	}
+
+	return !msg.Time.Before(b.started)
+}
+
+// Start backfills the logs of every running container. Checkpoints for
+// containers that no longer exist are removed.
+func (b *Backfiller) Start(out chan<- *router.Message) {
+	containers, err := b.client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		log.Errorf("Backfill failed - error: %v", err)
+		close(b.ready)
+		return
+	}
+
+	exists := map[string]bool{}
+	for _, c := range containers {
+		exists[c.ID] = true
+	}
+
+	for id := range b.since {
+		if !exists[id] {
+			b.checkpoint.Remove(id)
+		}
+	}
+
+	for _, c := range containers {
+		if _, ok := b.since[c.ID]; c.State == "running" && (ok || !b.saved.IsZero()) {
+			b.backfilled[c.ID] = true
+		}
+	}
+	close(b.ready)
+
+	for _, c := range containers {
+		if !b.backfilled[c.ID] {
+			continue
+		}
+
+		if err := b.backfill(c.ID, b.since[c.ID], out); err != nil {
+			log.Errorf("Backfill failed - container: %s, error: %v", c.ID, err)
+		}
+	}
+}
+
+func (b *Backfiller) backfill(id string, since time.Time, out chan<- *router.Message) error {
+	container, err := b.client.InspectContainer(id)
+	if err != nil {
+		return err
+	}
+
+	if since.IsZero() {
+		since = b.saved
+		if container.State.StartedAt.After(since) {
+			since = container.State.StartedAt
+		}
+	}
+
+	if oldest := b.started.Add(-maxEventAge); since.Before(oldest) {
+		since = oldest
+	}
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		b.scan(container, "stdout", since, stdout, out)
+	}()
+
+	go func() {
+		defer wg.Done()
+		b.scan(container, "stderr", since, stderr, out)
+	}()
+
+	// The API only accepts whole seconds, so logs up to a second before the
+	// checkpoint are returned and dropped while scanning.
+	err = b.client.Logs(docker.LogsOptions{
+		Container:    id,
+		OutputStream: stdoutWriter,
+		ErrorStream:  stderrWriter,
+		Since:        since.Unix(),
+		Stdout:       true,
+		Stderr:       true,
+		Timestamps:   true,
+		RawTerminal:  container.Config != nil && container.Config.Tty,
+	})
+
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+
+	return err
+}
+
+// scan sends each timestamped line written after the checkpoint and before
+// the adapter started.
+func (b *Backfiller) scan(container *docker.Container, source string, since time.Time, r io.Reader, out chan<- *router.Message) {
+	scanner := bufio.NewScanner(r)
+	count := 0
+
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil || !t.After(since) || !t.Before(b.started) {
+			continue
+		}
+
+		out <- &router.Message{Container: container, Source: source, Data: parts[1], Time: t}
+		count++
+	}
+
+	// Drain the rest of the stream so that the Docker client does not block.
+	io.Copy(ioutil.Discard, r)
+
+	log.Infof("Backfilled container logs - container: %s, source: %s, count: %d", container.ID, source, count)
+}
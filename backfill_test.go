@@ -0,0 +1,223 @@
+package cloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type BackfillSuite struct {
+	started    time.Time
+	checkpoint *Checkpoint
+	client     *fakeDockerClient
+}
+
+var _ = Suite(&BackfillSuite{})
+
+func (s *BackfillSuite) SetUpTest(c *C) {
+	s.started = time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC)
+	s.checkpoint, _ = NewCheckpoint(filepath.Join(c.MkDir(), "checkpoint.json"))
+	s.client = &fakeDockerClient{
+		containers: []docker.APIContainers{
+			{ID: "running", State: "running"},
+			{ID: "exited", State: "exited"},
+		},
+		logs: map[string][]string{},
+	}
+}
+
+func (s *BackfillSuite) TestPassesThroughWithoutBackfiller(c *C) {
+	input := make(chan *router.Message)
+	output := backfill(input, nil)
+
+	c.Assert(output, Equals, (<-chan *router.Message)(input))
+}
+
+func (s *BackfillSuite) TestBackfillsLogsSinceCheckpoint(c *C) {
+	s.checkpoint.Mark("running", s.started.Add(-time.Minute+time.Millisecond))
+	s.client.logs["running"] = []string{
+		s.line(-time.Minute, "before checkpoint"),
+		s.line(-time.Minute+time.Millisecond, "at checkpoint"),
+		s.line(-time.Second, "after checkpoint"),
+		s.line(0, "after start"),
+	}
+
+	input := make(chan *router.Message)
+	output := backfill(input, NewBackfiller(s.client, s.checkpoint, s.started))
+	close(input)
+
+	messages := []*router.Message{}
+	for msg := range output {
+		messages = append(messages, msg)
+	}
+
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].Data, Equals, "after checkpoint")
+	c.Assert(messages[0].Source, Equals, "stdout")
+	c.Assert(messages[0].Container.ID, Equals, "running")
+	c.Assert(messages[0].Time.Equal(s.started.Add(-time.Second)), Equals, true)
+	c.Assert(s.client.since["running"], Equals, s.started.Add(-time.Minute).Unix())
+}
+
+func (s *BackfillSuite) TestSkipsContainersWithoutCheckpointsWithoutStateFile(c *C) {
+	s.client.logs["running"] = []string{s.line(-5*time.Second, "history")}
+
+	input := make(chan *router.Message)
+	output := backfill(input, NewBackfiller(s.client, s.checkpoint, s.started))
+	close(input)
+
+	_, ok := <-output
+	c.Assert(ok, Equals, false)
+	c.Assert(s.client.since["running"], Equals, int64(0))
+}
+
+func (s *BackfillSuite) TestBackfillsContainersWithoutCheckpointsSinceLastSave(c *C) {
+	s.checkpoint = s.saved(c, s.started.Add(-10*time.Second))
+	s.client.startedAt = s.started.Add(-time.Hour)
+	s.client.logs["running"] = []string{
+		s.line(-20*time.Second, "delivered before restart"),
+		s.line(-5*time.Second, "written while down"),
+	}
+
+	input := make(chan *router.Message)
+	output := backfill(input, NewBackfiller(s.client, s.checkpoint, s.started))
+	close(input)
+
+	messages := []*router.Message{}
+	for msg := range output {
+		messages = append(messages, msg)
+	}
+
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].Data, Equals, "written while down")
+	c.Assert(s.client.since["running"], Equals, s.started.Add(-10*time.Second).Unix())
+}
+
+func (s *BackfillSuite) TestBackfillsContainersStartedWhileDownSinceTheyStarted(c *C) {
+	s.checkpoint = s.saved(c, s.started.Add(-time.Hour))
+	s.client.startedAt = s.started.Add(-10 * time.Second)
+
+	input := make(chan *router.Message)
+	output := backfill(input, NewBackfiller(s.client, s.checkpoint, s.started))
+	close(input)
+
+	for range output {
+	}
+
+	c.Assert(s.client.since["running"], Equals, s.client.startedAt.Unix())
+}
+
+func (s *BackfillSuite) TestNeverBackfillsExpiredLogs(c *C) {
+	s.checkpoint.Mark("running", s.started.Add(-30*24*time.Hour))
+
+	input := make(chan *router.Message)
+	output := backfill(input, NewBackfiller(s.client, s.checkpoint, s.started))
+	close(input)
+
+	for range output {
+	}
+
+	c.Assert(s.client.since["running"], Equals, s.started.Add(-maxEventAge).Unix())
+}
+
+func (s *BackfillSuite) TestOnlyBackfillsRunningContainers(c *C) {
+	s.checkpoint.Mark("exited", s.started.Add(-time.Minute))
+	s.client.logs["exited"] = []string{s.line(-time.Second, "exited")}
+
+	input := make(chan *router.Message)
+	output := backfill(input, NewBackfiller(s.client, s.checkpoint, s.started))
+	close(input)
+
+	_, ok := <-output
+	c.Assert(ok, Equals, false)
+}
+
+func (s *BackfillSuite) TestRemovesCheckpointsOfRemovedContainers(c *C) {
+	s.checkpoint.Mark("removed", s.started.Add(-time.Minute))
+
+	backfiller := NewBackfiller(s.client, s.checkpoint, s.started)
+	backfiller.Start(make(chan *router.Message))
+
+	_, ok := s.checkpoint.Get("removed")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *BackfillSuite) TestDropsLiveLogsCoveredByBackfill(c *C) {
+	s.checkpoint.Mark("running", s.started.Add(-time.Minute))
+	backfiller := NewBackfiller(s.client, s.checkpoint, s.started)
+	backfiller.Start(make(chan *router.Message))
+
+	live := func(id string, offset time.Duration) bool {
+		container := &docker.Container{ID: id}
+		return backfiller.Live(&router.Message{Container: container, Time: s.started.Add(offset)})
+	}
+
+	c.Assert(live("running", -time.Second), Equals, false)
+	c.Assert(live("running", 0), Equals, true)
+	c.Assert(live("exited", -time.Second), Equals, true)
+	c.Assert(live("new", -time.Second), Equals, true)
+}
+
+func (s *BackfillSuite) TestShipsLiveLogsWhenListingFails(c *C) {
+	s.client.err = errors.New("connection refused")
+	backfiller := NewBackfiller(s.client, s.checkpoint, s.started)
+	backfiller.Start(make(chan *router.Message))
+
+	live := backfiller.Live(&router.Message{Container: &docker.Container{ID: "running"}, Time: s.started.Add(-time.Second)})
+
+	c.Assert(live, Equals, true)
+}
+
+// saved returns a Checkpoint loaded from a state file last written at t.
+func (s *BackfillSuite) saved(c *C, t time.Time) *Checkpoint {
+	path := filepath.Join(c.MkDir(), "checkpoint.json")
+	c.Assert(ioutil.WriteFile(path, []byte("{}"), 0644), IsNil)
+	c.Assert(os.Chtimes(path, t, t), IsNil)
+
+	checkpoint, err := NewCheckpoint(path)
+	c.Assert(err, IsNil)
+
+	return checkpoint
+}
+
+func (s *BackfillSuite) line(offset time.Duration, data string) string {
+	return fmt.Sprintf("%s %s\n", s.started.Add(offset).Format(time.RFC3339Nano), data)
+}
+
+type fakeDockerClient struct {
+	containers []docker.APIContainers
+	logs       map[string][]string
+	since      map[string]int64
+	startedAt  time.Time
+	err        error
+}
+
+func (f *fakeDockerClient) ListContainers(opts docker.ListContainersOptions) ([]docker.APIContainers, error) {
+	return f.containers, f.err
+}
+
+func (f *fakeDockerClient) InspectContainer(id string) (*docker.Container, error) {
+	return &docker.Container{ID: id, Config: &docker.Config{}, State: docker.State{StartedAt: f.startedAt}}, nil
+}
+
+func (f *fakeDockerClient) Logs(opts docker.LogsOptions) error {
+	if f.since == nil {
+		f.since = map[string]int64{}
+	}
+	f.since[opts.Container] = opts.Since
+
+	for _, line := range f.logs[opts.Container] {
+		if _, err := opts.OutputStream.Write([]byte(line)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,14 @@
 package cloudwatch
 
 import (
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 )
 
-func batch(logs <-chan Log, capacity Capacity) <-chan []Log {
-	batches := make(chan []Log)
+func batch(logs <-chan Log, capacity Capacity) <-chan Batch {
+	batches := make(chan Batch)
 	batcher := NewBatcher(logs, batches, capacity)
 
 	go func() {
@@ -18,21 +19,37 @@ func batch(logs <-chan Log, capacity Capacity) <-chan []Log {
 	return batches
 }
 
-// Batcher buffers messages on a channel until a flush is triggered.
+// Batcher buffers messages on a channel until a flush is triggered. The flush
+// interval adapts to traffic: it widens while batches are sparse, up to the
+// capacity's MaxDuration, and narrows again when batches fill up.
 type Batcher struct {
 	in  <-chan Log
-	out chan<- []Log
+	out chan<- Batch
 
 	messages []Log
+	payload  *payload
 	capacity Capacity
 	timer    <-chan time.Time
 	size     int
+	duration time.Duration
+	oldest   int64
+	newest   int64
 }
 
 // NewBatcher creates a Batcher that buffers message from the input channel to the
 // output channel.
-func NewBatcher(in <-chan Log, out chan<- []Log, capacity Capacity) *Batcher {
-	return &Batcher{in: in, out: out, capacity: capacity}
+func NewBatcher(in <-chan Log, out chan<- Batch, capacity Capacity) *Batcher {
+	b := &Batcher{in: in, out: out, capacity: capacity, duration: capacity.Duration}
+	if capacity.Payload {
+		b.payload = newPayload()
+	}
+
+	return b
+}
+
+// Duration returns the current flush interval.
+func (b *Batcher) Duration() time.Duration {
+	return b.duration
 }
 
 // Length returns the current length of the buffer.
@@ -52,32 +69,80 @@ loop:
 
 			if b.willOverflow(l) {
 				log.Debugf("Batch flushed to prevent size overflow - size: %d, capacity: %v", b.size, b.capacity)
+				b.narrow()
+				b.flush()
+			} else if b.willOverspan(l) {
+				log.Debugf("Batch flushed to keep its time span within capacity - span: %dms, capacity: %v", b.newest-b.oldest, b.capacity)
 				b.flush()
 			}
 
-			b.messages = append(b.messages, l)
-			b.size += l.Size()
+			b.append(l)
 
 			if b.isFullSize() {
 				log.Debugf("Batch flushed due to batch size - size: %d, capacity: %v", b.size, b.capacity)
+				b.narrow()
 				b.flush()
 			} else if b.isFullLength() {
 				log.Debugf("Batch flushed due to batch length - length: %d, capacity: %v", len(b.messages), b.capacity)
+				b.narrow()
 				b.flush()
 			} else {
 				b.startFlushTimer()
 			}
 		case <-b.timer:
-			log.Debugf("Batch flushed due to timer - capacity: %v", b.capacity)
+			log.Debugf("Batch flushed due to timer - duration: %v, capacity: %v", b.duration, b.capacity)
+			if b.isSparse() {
+				b.widen()
+			}
 			b.flush()
 		}
 	}
 
+	// Remaining messages are flushed right away, as the stream is closing.
 	b.flush()
+
+	if b.payload != nil {
+		b.payload.release()
+	}
+}
+
+func (b *Batcher) append(l Log) {
+	if t := l.Timestamp(); len(b.messages) == 0 {
+		b.oldest, b.newest = t, t
+	} else if t < b.oldest {
+		b.oldest = t
+	} else if t > b.newest {
+		b.newest = t
+	}
+
+	b.messages = append(b.messages, l)
+	b.size += l.Size() + b.capacity.Overhead
+
+	if b.payload != nil {
+		b.payload.append(l)
+	}
+}
+
+// willOverspan reports whether adding the log would stretch the batch across
+// more time than the capacity's Span allows.
+func (b *Batcher) willOverspan(l Log) bool {
+	if b.capacity.Span <= 0 || len(b.messages) == 0 {
+		return false
+	}
+
+	oldest, newest, t := b.oldest, b.newest, l.Timestamp()
+	if t < oldest {
+		oldest = t
+	}
+	if t > newest {
+		newest = t
+	}
+
+	return newest-oldest >= int64(b.capacity.Span/time.Millisecond)
 }
 
 func (b *Batcher) willOverflow(log Log) bool {
-	return b.size+log.Size() > b.capacity.Size
+	return b.size+log.Size()+b.capacity.Overhead > b.capacity.Size
 }
 
 func (b *Batcher) isFullSize() bool {
@@ -88,28 +153,141 @@ func (b *Batcher) isFullLength() bool {
 	return len(b.messages) == b.capacity.Length
 }
 
+// isSparse reports whether the batch is less than half full.
+func (b *Batcher) isSparse() bool {
+	return b.size < b.capacity.Size/2 && len(b.messages) < b.capacity.Length/2
+}
+
+// widen doubles the flush interval, up to MaxDuration, so sparse logs are
+// sent in fewer requests.
+func (b *Batcher) widen() {
+	if b.duration*2 <= b.capacity.MaxDuration {
+		b.duration *= 2
+	} else if b.duration < b.capacity.MaxDuration {
+		b.duration = b.capacity.MaxDuration
+	}
+}
+
+// narrow halves the flush interval, down to Duration, so logs are sent
+// promptly once traffic picks up.
+func (b *Batcher) narrow() {
+	if b.duration/2 >= b.capacity.Duration {
+		b.duration /= 2
+	} else {
+		b.duration = b.capacity.Duration
+	}
+}
+
+// flush hands the buffered messages to the consumer, which owns them until
+// it releases the batch, and continues with a recycled buffer.
 func (b *Batcher) flush() {
-	messages := make([]Log, len(b.messages))
-	copy(messages, b.messages)
+	batch := Batch{Logs: b.messages, payload: b.payload}
 
 	b.timer = nil
-	b.messages = nil
 	b.size = 0
 
-	if len(messages) != 0 {
-		b.out <- messages
+	if len(batch.Logs) != 0 {
+		b.messages = batchBuffers.get()
+		if b.payload != nil {
+			b.payload = newPayload()
+		}
+		b.out <- batch
 	}
 }
 
 func (b *Batcher) startFlushTimer() {
-	if b.timer == nil && b.capacity.Duration > 0 {
-		b.timer = time.After(b.capacity.Duration)
+	if b.timer == nil && b.duration > 0 {
+		b.timer = b.capacity.clock().After(b.duration)
 	}
 }
 
-// Capacity returns conditions that trigger a Batcher to flush.
+// Capacity returns conditions that trigger a Batcher to flush. Duration is
+// the initial flush interval, which widens up to MaxDuration while traffic is
+// sparse. Durations are measured by Clock, which defaults to the system
+// clock.
 type Capacity struct {
-	Size     int
-	Length   int
-	Duration time.Duration
+	Size        int
+	Length      int
+	Duration    time.Duration
+	MaxDuration time.Duration
+	Clock       Clock
+
+	// Overhead is added to the size of each log, for services that count
+	// bytes per event on top of its body.
+	Overhead int
+
+	// Span limits how far apart the timestamps in a batch may be. Zero means
+	// no limit.
+	Span time.Duration
+
+	// Payload builds the CloudWatch events of each batch as its logs are
+	// added.
+	Payload bool
+}
+
+// Batch is a set of logs flushed by a Batcher. With a Payload capacity, it
+// carries the CloudWatch events of its logs.
+type Batch struct {
+	Logs []Log
+
+	payload *payload
+}
+
+func (c Capacity) clock() Clock {
+	if c.Clock == nil {
+		return realClock{}
+	}
+
+	return c.Clock
+}
+
+// batchBuffers recycles the buffers of released batches, so that batching
+// does not allocate once buffers have grown to the size of a batch.
+var batchBuffers = &bufferPool{}
+
+// bufferPool is a free list of batch buffers. Unlike sync.Pool, it stores
+// slices without allocating.
+type bufferPool struct {
+	mutex   sync.Mutex
+	buffers [][]Log
+}
+
+// bufferPoolSize is the number of free buffers kept for reuse.
+const bufferPoolSize = 16
+
+func (p *bufferPool) get() []Log {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.buffers) == 0 {
+		return nil
+	}
+
+	buffer := p.buffers[len(p.buffers)-1]
+	p.buffers = p.buffers[:len(p.buffers)-1]
+
+	return buffer
+}
+
+func (p *bufferPool) put(buffer []Log) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.buffers) < bufferPoolSize {
+		p.buffers = append(p.buffers, buffer[:0])
+	}
+}
+
+// releaseBatch returns the buffers of a batch for reuse once its consumer is
+// done with it. A batch must not be used after it is released.
+func releaseBatch(batch Batch) {
+	for i := range batch.Logs {
+		batch.Logs[i] = nil
+	}
+
+	batchBuffers.put(batch.Logs)
+
+	if batch.payload != nil {
+		batch.payload.release()
+	}
 }
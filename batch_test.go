@@ -4,6 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	"github.com/gliderlabs/logspout/router"
 	. "gopkg.in/check.v1"
 )
 
@@ -12,24 +15,45 @@ func TestBatch(t *testing.T) {
 }
 
 type BatchSuite struct {
-	in  chan Log
-	out chan []Log
+	in    chan Log
+	out   chan Batch
+	clock *test.FakeClock
 }
 
 var _ = Suite(&BatchSuite{})
 
 func (s *BatchSuite) SetUpTest(c *C) {
 	s.in = make(chan Log)
-	s.out = make(chan []Log)
+	s.out = make(chan Batch)
+	s.clock = test.NewFakeClock(time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC))
 }
 
 // TODO: Test closing channel.
 
+func (s *BatchSuite) TestBatcherFlushesBeforeSpanIsExceeded(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 10, Size: 100, Span: 24 * time.Hour})
+	go batcher.Start()
+
+	hour := int64(time.Hour / time.Millisecond)
+	s.in <- &FakeLog{timestamp: 30 * hour}
+	s.in <- &FakeLog{timestamp: 7 * hour}
+	s.in <- &FakeLog{timestamp: 31*hour + hour/2}
+
+	batch := (<-s.out).Logs
+	c.Assert(batch, HasLen, 2)
+	c.Assert(batch[0].Timestamp(), Equals, 30*hour)
+	c.Assert(batch[1].Timestamp(), Equals, 7*hour)
+
+	close(s.in)
+	c.Assert((<-s.out).Logs, HasLen, 1)
+}
+
 func (s *BatchSuite) TestBatcherWhenNotFull(c *C) {
-	batcher := NewBatcher(s.in, s.out, Capacity{Length: 2, Size: 2})
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 2, Size: 2, Duration: time.Second, Clock: s.clock})
 	go batcher.Start()
 
 	s.in <- &FakeLog{size: 0}
+	s.clock.WaitForWaiters(1, time.Second)
 
 	c.Assert(batcher.Length(), Equals, 1)
 }
@@ -41,7 +65,7 @@ func (s *BatchSuite) TestFlushWhenCountReached(c *C) {
 	s.in <- &FakeLog{size: 1}
 	s.in <- &FakeLog{size: 1}
 
-	messages := <-s.out
+	messages := (<-s.out).Logs
 
 	c.Assert(messages, HasLen, 2)
 	c.Assert(batcher.Length(), Equals, 0)
@@ -54,20 +78,21 @@ func (s *BatchSuite) TestFlushWhenSizeReached(c *C) {
 	s.in <- &FakeLog{size: 1}
 	s.in <- &FakeLog{size: 1}
 
-	messages := <-s.out
+	messages := (<-s.out).Logs
 
 	c.Assert(messages, HasLen, 2)
 	c.Assert(batcher.Length(), Equals, 0)
 }
 
 func (s *BatchSuite) TestFlushWhenSizeExceeded(c *C) {
-	batcher := NewBatcher(s.in, s.out, Capacity{Length: 4, Size: 3})
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 4, Size: 3, Duration: time.Second, Clock: s.clock})
 	go batcher.Start()
 
 	s.in <- &FakeLog{size: 2}
 	s.in <- &FakeLog{size: 2}
 
-	messages := <-s.out
+	messages := (<-s.out).Logs
+	s.clock.WaitForWaiters(2, time.Second)
 
 	c.Assert(messages, HasLen, 1)
 	c.Assert(batcher.Length(), Equals, 1)
@@ -79,21 +104,21 @@ func (s *BatchSuite) TestFlushOversizedMessage(c *C) {
 
 	s.in <- &FakeLog{size: 2}
 
-	messages := <-s.out
+	messages := (<-s.out).Logs
 
 	c.Assert(messages, HasLen, 1)
 	c.Assert(batcher.Length(), Equals, 0)
 }
 
 func (s *BatchSuite) TestFlushWhenDurationExceeded(c *C) {
-	duration := 1 * time.Millisecond
-	batcher := NewBatcher(s.in, s.out, Capacity{Length: 2, Size: 2, Duration: duration})
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 2, Size: 2, Duration: time.Second, Clock: s.clock})
 	go batcher.Start()
 
 	s.in <- &FakeLog{size: 1}
-	time.Sleep(2 * time.Millisecond)
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(time.Second)
 
-	messages := <-s.out
+	messages := (<-s.out).Logs
 
 	c.Assert(messages, HasLen, 1)
 	c.Assert(batcher.Length(), Equals, 0)
@@ -106,8 +131,147 @@ func (s *BatchSuite) TestFlushWhenClosed(c *C) {
 	s.in <- &FakeLog{size: 0}
 	close(s.in)
 
-	messages := <-s.out
+	messages := (<-s.out).Logs
 
 	c.Assert(messages, HasLen, 1)
 	c.Assert(batcher.Length(), Equals, 0)
 }
+
+func (s *BatchSuite) TestDoesNotFlushBeforeDuration(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 2, Size: 2, Duration: time.Second, Clock: s.clock})
+	go batcher.Start()
+
+	s.in <- &FakeLog{size: 1}
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(time.Second - time.Millisecond)
+
+	select {
+	case <-s.out:
+		c.Fatal("batch was flushed early")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.Assert(batcher.Length(), Equals, 1)
+}
+
+func (s *BatchSuite) TestWidensDurationWhileSparse(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 10, Size: 100, Duration: time.Second, MaxDuration: 3 * time.Second, Clock: s.clock})
+	go batcher.Start()
+
+	s.in <- &FakeLog{size: 1}
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(time.Second)
+	<-s.out
+
+	c.Assert(batcher.Duration(), Equals, 2*time.Second)
+
+	s.in <- &FakeLog{size: 1}
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(2 * time.Second)
+	<-s.out
+
+	c.Assert(batcher.Duration(), Equals, 3*time.Second)
+}
+
+func (s *BatchSuite) TestNarrowsDurationWhenFull(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 4, Size: 100, Duration: time.Second, MaxDuration: 4 * time.Second, Clock: s.clock})
+	go batcher.Start()
+
+	s.in <- &FakeLog{size: 1}
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(time.Second)
+	<-s.out
+
+	c.Assert(batcher.Duration(), Equals, 2*time.Second)
+
+	for i := 0; i < 4; i++ {
+		s.in <- &FakeLog{size: 1}
+	}
+	<-s.out
+
+	c.Assert(batcher.Duration(), Equals, time.Second)
+}
+
+func (s *BatchSuite) TestKeepsDurationWithoutMaxDuration(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 10, Size: 100, Duration: time.Second, Clock: s.clock})
+	go batcher.Start()
+
+	s.in <- &FakeLog{size: 1}
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(time.Second)
+	<-s.out
+
+	c.Assert(batcher.Duration(), Equals, time.Second)
+}
+
+func (s *BatchSuite) TestBatcherCountsOverheadOfEachLog(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 10, Size: 13, Overhead: 5})
+	go batcher.Start()
+
+	s.in <- &FakeLog{size: 1}
+	s.in <- &FakeLog{size: 1}
+	s.in <- &FakeLog{size: 1}
+
+	c.Assert((<-s.out).Logs, HasLen, 2)
+}
+
+func (s *BatchSuite) TestBatcherBuildsPayloadAsLogsArrive(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 2, Size: 100, Payload: true})
+	go batcher.Start()
+
+	s.in <- &LogMessage{Message: &router.Message{Data: "first", Time: time.Unix(2, 0)}}
+	s.in <- &LogMessage{Message: &router.Message{Data: "second", Time: time.Unix(1, 0)}}
+	batch := <-s.out
+	defer releaseBatch(batch)
+
+	c.Assert(batch.payload.events, HasLen, 2)
+	c.Assert(batch.payload.size, Equals, 11)
+	c.Assert(aws.StringValue(batch.payload.events[1].Message), Equals, "second")
+	c.Assert(aws.Int64Value(batch.payload.events[1].Timestamp), Equals, int64(1000))
+}
+
+func (s *BatchSuite) TestReleasingBatchDropsLogs(c *C) {
+	batcher := NewBatcher(s.in, s.out, Capacity{Length: 2, Size: 4})
+	go batcher.Start()
+
+	s.in <- &FakeLog{size: 1}
+	s.in <- &FakeLog{size: 1}
+	batch := <-s.out
+	releaseBatch(batch)
+
+	c.Assert(batch.Logs[0], IsNil)
+	c.Assert(batch.Logs[1], IsNil)
+}
+
+func (s *BatchSuite) TestBufferPoolRecyclesBuffers(c *C) {
+	pool := &bufferPool{}
+	buffer := make([]Log, 2, 8)
+
+	c.Assert(pool.get(), IsNil)
+
+	pool.put(buffer)
+	recycled := pool.get()
+
+	c.Assert(recycled, HasLen, 0)
+	c.Assert(cap(recycled), Equals, 8)
+	c.Assert(pool.get(), IsNil)
+}
+
+func BenchmarkBatcher(b *testing.B) {
+	input := make(chan Log)
+	batches := batch(input, Capacity{Size: batchSize, Length: batchLength, Duration: batchDuration})
+	log := &FakeLog{size: 100}
+
+	b.ReportAllocs()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			input <- log
+		}
+		close(input)
+	}()
+
+	for batch := range batches {
+		releaseBatch(batch)
+	}
+}
@@ -0,0 +1,112 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Overflow policies decide what happens to logs that arrive while the memory
+// budget is exhausted.
+const (
+	overflowBlock = "block"
+	overflowDrop  = "drop"
+)
+
+// memory is the budget shared by every adapter in the process.
+var memory = NewBudget()
+
+// Budget limits the bytes of logs held in memory by batchers and pending
+// uploads. Logs acquire their size before they are buffered and release it
+// once their batch is uploaded or given up on. Usage is tracked even without
+// a limit, so that it can be reported.
+type Budget struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	limit  int64
+	policy string
+	used   int64
+}
+
+// NewBudget creates a Budget without a limit.
+func NewBudget() *Budget {
+	b := &Budget{policy: overflowBlock}
+	b.cond = sync.NewCond(&b.mutex)
+
+	return b
+}
+
+// Configure sets the limit in bytes and the overflow policy. As the budget is
+// shared, routes must not configure conflicting limits.
+func (b *Budget) Configure(limit int64, policy string) error {
+	if policy != overflowBlock && policy != overflowDrop {
+		return fmt.Errorf("invalid memory overflow policy: %s", policy)
+	}
+
+	if limit < 0 {
+		return fmt.Errorf("invalid memory limit: %d", limit)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.limit != 0 && (b.limit != limit || b.policy != policy) {
+		return fmt.Errorf("conflicting memory limit: %d, policy: %s", limit, policy)
+	}
+
+	b.limit = limit
+	b.policy = policy
+
+	return nil
+}
+
+// Acquire reserves bytes for a log. When the budget is exhausted, the block
+// policy waits until bytes are released, and the drop policy returns false.
+// A log is always admitted when nothing else is held, so a log larger than
+// the limit cannot wait forever.
+func (b *Budget) Acquire(bytes int) bool {
+	return b.AcquireShare(bytes, 1)
+}
+
+// AcquireShare reserves bytes for a log like Acquire. Under the drop policy,
+// the log is only admitted while the budget stays within a share of the
+// limit, so lower-priority logs are dropped before higher-priority logs.
+// Under the block policy, every log waits for the whole limit, so none are
+// dropped.
+func (b *Budget) AcquireShare(bytes int, share float64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	limit := b.limit
+	if b.policy == overflowDrop {
+		limit = int64(float64(b.limit) * share)
+	}
+
+	for b.limit > 0 && b.used > 0 && b.used+int64(bytes) > limit {
+		if b.policy == overflowDrop {
+			return false
+		}
+
+		b.cond.Wait()
+	}
+
+	b.used += int64(bytes)
+
+	return true
+}
+
+// Release returns bytes acquired by logs that are no longer held.
+func (b *Budget) Release(bytes int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.used -= int64(bytes)
+	b.cond.Broadcast()
+}
+
+// Used returns the bytes currently held.
+func (b *Budget) Used() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.used
+}
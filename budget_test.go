@@ -0,0 +1,114 @@
+package cloudwatch
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type BudgetSuite struct{}
+
+var _ = Suite(&BudgetSuite{})
+
+func (s *BudgetSuite) TestTracksUsageWithoutLimit(c *C) {
+	budget := NewBudget()
+
+	c.Assert(budget.Acquire(10), Equals, true)
+	c.Assert(budget.Acquire(5), Equals, true)
+	c.Assert(budget.Used(), Equals, int64(15))
+
+	budget.Release(10)
+
+	c.Assert(budget.Used(), Equals, int64(5))
+}
+
+func (s *BudgetSuite) TestDropsOverLimit(c *C) {
+	budget := NewBudget()
+	c.Assert(budget.Configure(10, "drop"), IsNil)
+
+	c.Assert(budget.Acquire(8), Equals, true)
+	c.Assert(budget.Acquire(5), Equals, false)
+
+	budget.Release(8)
+
+	c.Assert(budget.Acquire(5), Equals, true)
+}
+
+func (s *BudgetSuite) TestAdmitsOversizedLogWhenEmpty(c *C) {
+	budget := NewBudget()
+	c.Assert(budget.Configure(10, "drop"), IsNil)
+
+	c.Assert(budget.Acquire(20), Equals, true)
+	c.Assert(budget.Acquire(1), Equals, false)
+}
+
+func (s *BudgetSuite) TestBlocksUntilReleased(c *C) {
+	budget := NewBudget()
+	c.Assert(budget.Configure(10, "block"), IsNil)
+	budget.Acquire(8)
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- budget.Acquire(5)
+	}()
+
+	select {
+	case <-acquired:
+		c.Fatal("log was admitted over the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	budget.Release(8)
+
+	c.Assert(<-acquired, Equals, true)
+	c.Assert(budget.Used(), Equals, int64(5))
+}
+
+func (s *BudgetSuite) TestRejectsInvalidConfiguration(c *C) {
+	budget := NewBudget()
+
+	c.Assert(budget.Configure(10, "spill"), ErrorMatches, "invalid memory overflow policy: spill")
+	c.Assert(budget.Configure(-1, "block"), ErrorMatches, "invalid memory limit: -1")
+}
+
+func (s *BudgetSuite) TestRejectsConflictingLimits(c *C) {
+	budget := NewBudget()
+
+	c.Assert(budget.Configure(10, "block"), IsNil)
+	c.Assert(budget.Configure(10, "block"), IsNil)
+	c.Assert(budget.Configure(20, "block"), ErrorMatches, "conflicting memory limit: 20, policy: block")
+}
+
+func (s *BudgetSuite) TestDropsWithinShare(c *C) {
+	budget := NewBudget()
+	c.Assert(budget.Configure(100, "drop"), IsNil)
+
+	c.Assert(budget.AcquireShare(40, 0.5), Equals, true)
+	c.Assert(budget.AcquireShare(20, 0.5), Equals, false)
+	c.Assert(budget.AcquireShare(20, 1), Equals, true)
+	c.Assert(budget.Used(), Equals, int64(60))
+}
+
+func (s *BudgetSuite) TestBlocksSharesForTheWholeLimit(c *C) {
+	budget := NewBudget()
+	c.Assert(budget.Configure(100, "block"), IsNil)
+
+	c.Assert(budget.AcquireShare(40, 0.5), Equals, true)
+	c.Assert(budget.AcquireShare(20, 0.5), Equals, true)
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- budget.AcquireShare(50, 0.5)
+	}()
+
+	select {
+	case <-acquired:
+		c.Fatal("log was admitted over the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	budget.Release(40)
+
+	c.Assert(<-acquired, Equals, true)
+	c.Assert(budget.Used(), Equals, int64(70))
+}
@@ -0,0 +1,190 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// checkpointInterval is how often checkpoints are written to the state file.
+const checkpointInterval = 5 * time.Second
+
+// Checkpoint records the time of the last log delivered for each container,
+// and persists it to a state file so that logs written while logspout was
+// down can be backfilled after a restart.
+type Checkpoint struct {
+	Path string
+
+	mutex sync.Mutex
+	times map[string]time.Time
+	dirty bool
+	saved time.Time
+}
+
+// checkpoints holds the Checkpoint of each state file, so that routes sharing
+// a file share its checkpoints instead of overwriting each other's saves.
+var checkpoints = struct {
+	sync.Mutex
+	paths map[string]*Checkpoint
+}{paths: map[string]*Checkpoint{}}
+
+// OpenCheckpoint returns the Checkpoint for a state file, loading it the
+// first time the file is used.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	checkpoints.Lock()
+	defer checkpoints.Unlock()
+
+	if c, ok := checkpoints.paths[path]; ok {
+		return c, nil
+	}
+
+	c, err := NewCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints.paths[path] = c
+
+	return c, nil
+}
+
+// NewCheckpoint instantiates a Checkpoint, loading the state file if it
+// exists.
+func NewCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{Path: path, times: map[string]time.Time{}}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.times); err != nil {
+		return nil, err
+	}
+	c.saved = info.ModTime()
+
+	return c, nil
+}
+
+// Saved returns when the state file was last written before it was loaded,
+// which is roughly when logspout stopped. It is zero without a state file.
+func (c *Checkpoint) Saved() time.Time {
+	return c.saved
+}
+
+// Get returns the checkpoint for a container.
+func (c *Checkpoint) Get(id string) (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t, ok := c.times[id]
+	return t, ok
+}
+
+// Snapshot returns a copy of the checkpoints of all containers.
+func (c *Checkpoint) Snapshot() map[string]time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	times := make(map[string]time.Time, len(c.times))
+	for id, t := range c.times {
+		times[id] = t
+	}
+
+	return times
+}
+
+// Mark advances the checkpoint for a container to a delivered log. Batches
+// can be delivered out of order, so checkpoints never move backwards.
+func (c *Checkpoint) Mark(id string, t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if t.After(c.times[id]) {
+		c.times[id] = t
+		c.dirty = true
+	}
+}
+
+// Remove forgets the checkpoint for a container, e.g. once it is removed.
+func (c *Checkpoint) Remove(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.times[id]; ok {
+		delete(c.times, id)
+		c.dirty = true
+	}
+}
+
+// Save writes the checkpoints to the state file if they have changed. The
+// file is replaced atomically so that a crash never leaves it truncated.
+func (c *Checkpoint) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.times)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.Path), filepath.Base(c.Path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.Path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.dirty = false
+
+	return nil
+}
+
+// Start saves checkpoints on every interval until done is closed.
+func (c *Checkpoint) Start(interval time.Duration, clock Clock, done <-chan struct{}) {
+	for {
+		select {
+		case <-clock.After(interval):
+			c.save()
+		case <-done:
+			c.save()
+			return
+		}
+	}
+}
+
+func (c *Checkpoint) save() {
+	if err := c.Save(); err != nil {
+		log.Errorf("Checkpoint save failed - path: %s, error: %v", c.Path, err)
+	}
+}
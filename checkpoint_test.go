@@ -0,0 +1,106 @@
+package cloudwatch
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	. "gopkg.in/check.v1"
+)
+
+type CheckpointSuite struct {
+	path string
+}
+
+var _ = Suite(&CheckpointSuite{})
+
+func (s *CheckpointSuite) SetUpTest(c *C) {
+	s.path = filepath.Join(c.MkDir(), "checkpoint.json")
+}
+
+func (s *CheckpointSuite) TestStartsEmptyWithoutStateFile(c *C) {
+	checkpoint, err := NewCheckpoint(s.path)
+
+	c.Assert(err, IsNil)
+	c.Assert(checkpoint.Snapshot(), HasLen, 0)
+}
+
+func (s *CheckpointSuite) TestPersistsCheckpoints(c *C) {
+	t := time.Date(2016, 5, 5, 12, 0, 0, 123, time.UTC)
+
+	checkpoint, _ := NewCheckpoint(s.path)
+	checkpoint.Mark("abc", t)
+	c.Assert(checkpoint.Save(), IsNil)
+
+	loaded, err := NewCheckpoint(s.path)
+	c.Assert(err, IsNil)
+
+	saved, ok := loaded.Get("abc")
+	c.Assert(ok, Equals, true)
+	c.Assert(saved.Equal(t), Equals, true)
+}
+
+func (s *CheckpointSuite) TestSavesOnEveryInterval(c *C) {
+	clock := test.NewFakeClock(time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC))
+	checkpoint, _ := NewCheckpoint(s.path)
+	checkpoint.Mark("abc", clock.Now())
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		checkpoint.Start(checkpointInterval, clock, done)
+	}()
+
+	clock.WaitForWaiters(1, time.Second)
+	clock.Advance(checkpointInterval)
+	clock.WaitForWaiters(1, time.Second)
+
+	loaded, err := NewCheckpoint(s.path)
+	c.Assert(err, IsNil)
+	_, ok := loaded.Get("abc")
+	c.Assert(ok, Equals, true)
+
+	close(done)
+	<-stopped
+}
+
+func (s *CheckpointSuite) TestNeverMovesBackwards(c *C) {
+	t := time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC)
+
+	checkpoint, _ := NewCheckpoint(s.path)
+	checkpoint.Mark("abc", t)
+	checkpoint.Mark("abc", t.Add(-time.Second))
+
+	saved, _ := checkpoint.Get("abc")
+	c.Assert(saved, Equals, t)
+}
+
+func (s *CheckpointSuite) TestRemovesCheckpoints(c *C) {
+	checkpoint, _ := NewCheckpoint(s.path)
+	checkpoint.Mark("abc", time.Now())
+	checkpoint.Remove("abc")
+
+	_, ok := checkpoint.Get("abc")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *CheckpointSuite) TestSharesCheckpointsOfAStateFile(c *C) {
+	first, err := OpenCheckpoint(s.path)
+	c.Assert(err, IsNil)
+
+	second, _ := OpenCheckpoint(s.path)
+	other, _ := OpenCheckpoint(s.path + ".other")
+
+	c.Assert(second, Equals, first)
+	c.Assert(other, Not(Equals), first)
+}
+
+func (s *CheckpointSuite) TestRejectsCorruptStateFile(c *C) {
+	c.Assert(ioutil.WriteFile(s.path, []byte("{"), 0644), IsNil)
+
+	_, err := NewCheckpoint(s.path)
+
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,20 @@
+package cloudwatch
+
+import "time"
+
+// Clock tells the time and waits for durations, so that time-driven logic
+// can be tested without sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
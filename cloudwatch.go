@@ -1,13 +1,18 @@
 package cloudwatch
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/aws/session"
+	docker "github.com/fsouza/go-dockerclient"
 	"github.com/gliderlabs/logspout/router"
 )
 
@@ -16,8 +21,30 @@ import (
 // in how batch size is calculated.
 const batchSize = 900000
 const batchLength = 10000
+
+// CloudWatch Logs counts 26 bytes for each event on top of its message when
+// checking the size of a batch.
+const eventOverhead = 26
 const batchDuration = 250 * time.Millisecond
 
+// CloudWatch Logs accepts 5 PutLogEvents requests per second for each stream.
+// Requests to a stream draw from a token bucket that refills one request every
+// streamRequestInterval and holds up to streamRequestBurst requests, so
+// concurrent uploads can start together while the rate stays within the
+// limit.
+const (
+	streamRequestInterval = 200 * time.Millisecond
+	streamRequestBurst    = 5
+)
+
+// Destinations that stop receiving logs, such as streams for a past rotation
+// period or a removed container, are closed once they have been idle.
+const destinationIdle = 10 * time.Minute
+
+// destinationBuffer is how many logs each destination lane holds, so a
+// destination whose uploads are stalled does not hold up the others.
+const destinationBuffer = 1000
+
 func init() {
 	router.AdapterFactories.Register(NewAdapter, "cloudwatch")
 }
@@ -25,8 +52,54 @@ func init() {
 // Adapter ships logs to AWS CloudWatch.
 type Adapter struct {
 	route     *router.Route
-	logstream *LogStream
+	session   *session.Session
+	service   *aws.Config
+	namer     *Namer
 	capacity  Capacity
+	sources   []string
+	format    string
+	sampler   *Sampler
+	window    time.Duration
+	sanitize  bool
+	extractor *TimestampExtractor
+	emf       *EMF
+	interval  time.Duration
+	stats     *Stats
+	metrics   *Metrics
+	flush     time.Duration
+	sinks     []Sink
+
+	prioritizer *Prioritizer
+
+	checkpoint *Checkpoint
+	docker     DockerClient
+	clock      Clock
+	budget     *Budget
+
+	tokenless   bool
+	concurrency int
+
+	mutex      sync.Mutex
+	logstreams map[Destination]*streamEntry
+}
+
+// streamEntry holds the log stream of a destination, which is created the
+// first time it is needed. Its mutex serializes creation without holding the
+// adapter's mutex across the requests to CloudWatch. An idle destination may
+// be reopened while its previous batcher is still uploading, so the entry
+// counts the batchers using it and is removed once the last one stops.
+type streamEntry struct {
+	mutex     sync.Mutex
+	logstream *LogStream
+	refs      int
+
+	// tokens serializes uploads that use sequence tokens, which may come
+	// from both batchers of a reopened destination.
+	tokens sync.Mutex
+
+	// next is the time at which the stream's token bucket is full again,
+	// less one request. It is guarded by the adapter's mutex.
+	next time.Time
 }
 
 func init() {
@@ -38,47 +111,623 @@ func init() {
 	log.SetLevel(level)
 }
 
+// AdapterConfig holds the dependencies of an adapter. Zero values are
+// replaced with defaults, so tests only set what they replace.
+type AdapterConfig struct {
+	// AWS is applied on top of the AWS configuration of the route.
+	AWS *aws.Config
+
+	// Hostname returns the name of the host, which is the default stream.
+	Hostname func() (string, error)
+
+	// Docker reads container logs when backfilling.
+	Docker DockerClient
+
+	// Clock drives the adapter's timers.
+	Clock Clock
+
+	// Budget limits the memory held by the adapter's batches. It defaults to
+	// the budget shared by every adapter in the process.
+	Budget *Budget
+}
+
 // NewAdapter instances a new AWS CloudWatch adapter.
 func NewAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter, err := NewAdapterWithConfig(route, AdapterConfig{})
+	if err != nil {
+		return nil, err
+	}
+
+	return adapter, nil
+}
+
+// NewAdapterWithConfig instances a new AWS CloudWatch adapter with replaced
+// dependencies.
+func NewAdapterWithConfig(route *router.Route, config AdapterConfig) (*Adapter, error) {
+	if config.Hostname == nil {
+		config.Hostname = os.Hostname
+	}
+
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+
+	if config.Budget == nil {
+		config.Budget = memory
+	}
+
+	hostname, err := config.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
 	group := route.Address
-	stream, err := os.Hostname()
+	stream := getopt(route, "stream", hostname)
+
+	namer, err := NewNamer(
+		group,
+		stream,
+		getopt(route, "stderr_stream", ""),
+		getopt(route, "stream_rotation", ""),
+		hostname,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := NewSession(route)
 	if err != nil {
 		return nil, err
 	}
 
-	logstream, err := NewLogStream(group, stream)
+	if config.AWS != nil {
+		session = session.Copy(config.AWS)
+	}
+
+	service := NewServiceConfig(route)
+
+	tokenless, err := strconv.ParseBool(getopt(route, "tokenless", "false"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Uploads to a stream can only run concurrently without sequence tokens.
+	concurrency := 1
+	if tokenless {
+		concurrency, err = strconv.Atoi(getopt(route, "upload_concurrency", "4"))
+		if err != nil || concurrency < 1 {
+			return nil, fmt.Errorf("invalid upload concurrency: %s", getopt(route, "upload_concurrency", ""))
+		}
+	}
+
+	// Streams with static names are created up front so that configuration
+	// errors are reported at startup. Templated streams are created as logs
+	// arrive.
+	logstreams := map[Destination]*streamEntry{}
+	if namer.Static() {
+		logstream, err := NewLogStream(session, group, stream, tokenless, service)
+		if err != nil {
+			return nil, err
+		}
+		logstreams[Destination{Group: group, Stream: stream}] = &streamEntry{logstream: logstream}
+	}
+
+	maxLatency, err := parseDuration(getopt(route, "batch_max_latency", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if maxLatency != 0 && maxLatency < batchDuration {
+		return nil, fmt.Errorf("invalid batch max latency: %v", maxLatency)
+	}
+
+	var limit int64
+	if value := getopt(route, "memory_limit", ""); value != "" {
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := config.Budget.Configure(limit, getopt(route, "memory_overflow", overflowBlock)); err != nil {
+			return nil, err
+		}
+	}
+
+	priorityRules, err := ParsePriorityRules(getopt(route, "priority_rules", ""))
 	if err != nil {
 		return nil, err
 	}
 
 	capacity := Capacity{
-		Size:     batchSize,
-		Length:   batchLength,
-		Duration: batchDuration,
+		Size:        batchSize,
+		Length:      batchLength,
+		Overhead:    eventOverhead,
+		Duration:    batchDuration,
+		MaxDuration: maxLatency,
+		Span:        maxBatchSpan,
+		Payload:     true,
+		Clock:       config.Clock,
+	}
+
+	sampler, err := NewSampler(
+		getopt(route, "sample_rate", ""),
+		getopt(route, "sample_field", ""),
+		getopt(route, "sample_pattern", ""),
+		getopt(route, "sample_never", ""),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	window, err := parseDuration(getopt(route, "dedupe_window", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	sanitize, err := strconv.ParseBool(getopt(route, "sanitize", "false"))
+	if err != nil {
+		return nil, err
+	}
+
+	extractor, err := NewTimestampExtractor(
+		getopt(route, "timestamp_field", ""),
+		getopt(route, "timestamp_pattern", ""),
+		getopt(route, "timestamp_layout", ""),
+		getopt(route, "timestamp_timezone", ""),
+		getopt(route, "timestamp_max_skew", ""),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []string
+	if value := getopt(route, "sources", ""); value != "" {
+		for _, source := range strings.Split(value, ",") {
+			source = strings.TrimSpace(source)
+			if source != "stdout" && source != "stderr" {
+				return nil, fmt.Errorf("invalid source: %s", source)
+			}
+			sources = append(sources, source)
+		}
+	}
+
+	format := getopt(route, "format", "raw")
+	if format != "raw" && format != "json" && format != "emf" {
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+
+	var e *EMF
+	if format == "emf" {
+		e, err = NewEMF(
+			getopt(route, "emf_namespace", "logspout-cloudwatch"),
+			getopt(route, "emf_dimensions", "container,image,host"),
+			getopt(route, "emf_metrics", ""),
+			hostname,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	interval, err := parseDuration(getopt(route, "emf_stats_interval", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if e != nil && interval > 0 {
+		if _, err := namer.Destination(e.Stats(StatsSnapshot{}, time.Time{})); err != nil {
+			return nil, fmt.Errorf("emf_stats_interval requires a log group that does not depend on the container: %v", err)
+		}
+	}
+
+	rules, err := ParseMetricRules(getopt(route, "metric_rules", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	// Buffered bytes are published alongside rule metrics, and on their own
+	// when memory is limited, whatever the format of the logs.
+	var m *Metrics
+	if len(rules) != 0 || limit > 0 {
+		m = NewMetrics(session, getopt(route, "metrics_namespace", "logspout-cloudwatch"), rules)
+		m.Budget = config.Budget
+		m.Hostname = hostname
+	}
+
+	flush, err := parseDuration(getopt(route, "metrics_interval", "1m"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []Sink
+	if bucket := getopt(route, "fallback_s3_bucket", ""); bucket != "" {
+		sinks = append(sinks, NewS3Sink(session, bucket, getopt(route, "fallback_s3_prefix", "")))
+	}
+
+	if dir := getopt(route, "dead_letter_dir", ""); dir != "" {
+		maxSize, err := strconv.ParseInt(getopt(route, "dead_letter_max_size", "104857600"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		maxFiles, err := strconv.Atoi(getopt(route, "dead_letter_max_files", "10"))
+		if err != nil {
+			return nil, err
+		}
+
+		sink, err := NewFileSink(dir, maxSize, maxFiles)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	var checkpoint *Checkpoint
+	if path := getopt(route, "checkpoint_file", ""); path != "" {
+		checkpoint, err = OpenCheckpoint(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if config.Docker == nil {
+			client, err := docker.NewClientFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			config.Docker = client
+		}
 	}
 
 	log.Infof("Created CloudWatch adapter - group: %s, stream: %s", group, stream)
 
-	return &Adapter{route: route, logstream: logstream, capacity: capacity}, nil
+	return &Adapter{
+		route:       route,
+		session:     session,
+		service:     service,
+		namer:       namer,
+		logstreams:  logstreams,
+		capacity:    capacity,
+		sources:     sources,
+		format:      format,
+		sampler:     sampler,
+		window:      window,
+		sanitize:    sanitize,
+		extractor:   extractor,
+		emf:         e,
+		interval:    interval,
+		stats:       &Stats{budget: config.Budget},
+		metrics:     m,
+		flush:       flush,
+		sinks:       sinks,
+		tokenless:   tokenless,
+		concurrency: concurrency,
+		checkpoint:  checkpoint,
+		docker:      config.Docker,
+		clock:       config.Clock,
+		budget:      config.Budget,
+		prioritizer: NewPrioritizer(priorityRules, format != "raw"),
+	}, nil
 }
 
 // Stream passes messages from a logspout message channel to AWS CloudWatch.
 func (a *Adapter) Stream(logstream chan *router.Message) {
 	log.Infof("CloudWatch adapter is streaming Docker logs")
 
-	logs := filter(transform(logstream))
-	batches := batch(logs, a.capacity)
+	var backfiller *Backfiller
+	if a.checkpoint != nil {
+		backfiller = NewBackfiller(a.docker, a.checkpoint, a.clock.Now())
+
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+			a.checkpoint.Start(checkpointInterval, a.clock, done)
+		}()
+
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+	}
+
+	// Stages that handle one log at a time run as steps in a single
+	// goroutine. Only stages with timers run in goroutines of their own.
+	logs := transform(
+		backfill(logstream, backfiller),
+		sourcesStep(a.sources),
+		sanitizeStep(a.sanitize),
+		filterStep,
+		measureStep(a.metrics),
+		timestampStep(a.extractor),
+		structureStep(a.format == "json"),
+		emfStep(a.emf),
+	)
+	logs = sample(dedupe(logs, a.window, a.clock), a.sampler)
+	logs = publishStats(logs, a.emf, a.stats, a.interval, a.clock)
+
+	if a.metrics != nil && a.flush > 0 {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+			a.metrics.Start(a.flush, a.clock, done)
+		}()
+
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+	}
+
+	a.dispatch(logs)
+}
+
+// destination holds the input of a destination's batcher for each lane.
+type destination struct {
+	lanes []chan Log
+	used  time.Time
+}
+
+func (d *destination) close() {
+	for _, lane := range d.lanes {
+		close(lane)
+	}
+}
+
+// dispatch sends each log to the batcher for its destination, starting a
+// batcher the first time a destination is used.
+func (a *Adapter) dispatch(logs <-chan Log) {
+	var wg sync.WaitGroup
+	destinations := map[Destination]*destination{}
+
+	var idle <-chan time.Time
+	if !a.namer.Static() {
+		idle = a.clock.After(destinationIdle)
+	}
+
+loop:
+	for {
+		select {
+		case l, ok := <-logs:
+			if !ok {
+				break loop
+			}
+
+			dest, err := a.namer.Destination(l)
+			if err != nil {
+				log.Errorf("Dropping log with invalid destination - error: %v", err)
+				continue
+			}
+
+			// The log's bytes are released once its batch is uploaded.
+			// Under the drop policy, lower lanes are dropped first.
+			lane := a.prioritizer.Priority(l)
+			if !a.acquire(l, lane) {
+				log.Debugf("Dropping log over memory limit - group: %s, stream: %s, priority: %d", dest.Group, dest.Stream, lane)
+				a.stats.Overflowed(1)
+				continue
+			}
 
-	for batch := range batches {
-		events := make([]*cloudwatchlogs.InputLogEvent, len(batch))
+			d, ok := destinations[dest]
+			if !ok {
+				d = &destination{lanes: make([]chan Log, a.prioritizer.Lanes())}
+				batches := make([]<-chan Batch, len(d.lanes))
+				for i := range d.lanes {
+					d.lanes[i] = make(chan Log, destinationBuffer)
+					batches[i] = batch(d.lanes[i], a.capacity)
+				}
+				destinations[dest] = d
 
-		for i, log := range batch {
-			events[i] = &cloudwatchlogs.InputLogEvent{
-				Message:   aws.String(log.Body()),
-				Timestamp: aws.Int64(log.Timestamp()),
+				wg.Add(1)
+				go func(dest Destination, batches []<-chan Batch) {
+					defer wg.Done()
+					a.upload(dest, a.schedule(dest, batches))
+				}(dest, batches)
 			}
+
+			d.used = a.clock.Now()
+			d.lanes[lane] <- l
+		case <-idle:
+			idle = a.clock.After(destinationIdle)
+
+			for dest, d := range destinations {
+				if a.clock.Now().Sub(d.used) >= destinationIdle {
+					log.Debugf("Closing idle destination - group: %s, stream: %s", dest.Group, dest.Stream)
+					d.close()
+					delete(destinations, dest)
+				}
+			}
+		}
+	}
+
+	for _, d := range destinations {
+		d.close()
+	}
+
+	wg.Wait()
+}
+
+// acquire reserves memory for a log in a lane.
+func (a *Adapter) acquire(l Log, lane int) bool {
+	return a.budget.AcquireShare(l.Size(), laneShares[lane])
+}
+
+func (a *Adapter) upload(dest Destination, batches <-chan Batch) {
+	entry := a.retainStream(dest)
+	defer a.releaseStream(dest, entry)
+
+	var wg sync.WaitGroup
+	uploads := make(chan struct{}, a.concurrency)
+
+	// A batch is only taken once an upload slot is free, so the scheduler
+	// picks the highest-priority batch waiting at that time. The batch then
+	// waits for the stream's request rate while the next batch fills up.
+	for {
+		uploads <- struct{}{}
+
+		batch, ok := <-batches
+		if !ok {
+			break
 		}
 
-		a.logstream.Log(events)
+		if wait := a.reserve(entry); wait > 0 {
+			log.Debugf("Log upload throttled - group: %s, stream: %s, wait: %v", dest.Group, dest.Stream, wait)
+			<-a.clock.After(wait)
+		}
+
+		wg.Add(1)
+
+		go func(batch Batch) {
+			defer wg.Done()
+			a.put(dest, entry, batch)
+			<-uploads
+		}(batch)
 	}
+
+	wg.Wait()
+}
+
+func (a *Adapter) put(dest Destination, entry *streamEntry, batch Batch) {
+	defer releaseBatch(batch)
+
+	payload := batch.payload
+	defer a.budget.Release(payload.size)
+
+	// CloudWatch rejects batches that are not in chronological order,
+	// which can happen when stages hold messages back.
+	if !payload.chronological() {
+		payload.sort()
+	}
+
+	logstream, err := a.logstream(dest, entry)
+	if err != nil {
+		log.Errorf("Log upload failed - group: %s, stream: %s, length: %d, error: %v", dest.Group, dest.Stream, len(batch.Logs), err)
+	} else {
+		if !a.tokenless {
+			entry.tokens.Lock()
+		}
+		err = logstream.Log(payload.events)
+		if !a.tokenless {
+			entry.tokens.Unlock()
+		}
+	}
+
+	if err != nil {
+		a.stats.Failed(len(payload.events))
+		writeSinks(a.sinks, dest, payload.events, err)
+	} else {
+		a.stats.Delivered(len(payload.events), payload.size)
+		a.mark(batch.Logs)
+	}
+}
+
+// mark advances the checkpoint of each container in a delivered batch.
+func (a *Adapter) mark(batch []Log) {
+	if a.checkpoint == nil {
+		return
+	}
+
+	for _, l := range batch {
+		if msg, ok := l.(*LogMessage); ok && msg.Container != nil {
+			a.checkpoint.Mark(msg.Container.ID, msg.Time)
+		}
+	}
+}
+
+// logstream returns the LogStream for a destination, creating it the first
+// time the destination is used.
+func (a *Adapter) logstream(dest Destination, entry *streamEntry) (*LogStream, error) {
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if entry.logstream != nil {
+		return entry.logstream, nil
+	}
+
+	logstream, err := NewLogStream(a.session, dest.Group, dest.Stream, a.tokenless, a.service)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Created CloudWatch log stream - group: %s, stream: %s", dest.Group, dest.Stream)
+	entry.logstream = logstream
+
+	return logstream, nil
+}
+
+// reserve returns how long to wait before the next request to a stream, and
+// reserves that request. Up to streamRequestBurst requests start right away,
+// and further requests are streamRequestInterval apart, whichever lane or
+// batcher they come from.
+func (a *Adapter) reserve(entry *streamEntry) time.Duration {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := a.clock.Now()
+	if entry.next.Before(now) {
+		entry.next = now
+	}
+
+	wait := entry.next.Sub(now) - (streamRequestBurst-1)*streamRequestInterval
+	if wait < 0 {
+		wait = 0
+	}
+	entry.next = entry.next.Add(streamRequestInterval)
+
+	return wait
+}
+
+// retainStream returns the stream entry of a destination, adding one if it
+// has none, and counts the caller as using it.
+func (a *Adapter) retainStream(dest Destination) *streamEntry {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry, ok := a.logstreams[dest]
+	if !ok {
+		entry = &streamEntry{}
+		a.logstreams[dest] = entry
+	}
+	entry.refs++
+
+	return entry
+}
+
+// releaseStream stops counting the caller as using a stream entry. Templated
+// destinations are forgotten once nothing uses them, so their streams are
+// looked up again if they are reopened.
+func (a *Adapter) releaseStream(dest Destination, entry *streamEntry) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry.refs--
+	if entry.refs == 0 && !a.namer.Static() && a.logstreams[dest] == entry {
+		delete(a.logstreams, dest)
+	}
+}
+
+// getopt reads an option from the route, falling back to an environment
+// variable of the same name in upper case.
+func getopt(route *router.Route, name, dfault string) string {
+	if value, ok := route.Options[name]; ok && value != "" {
+		return value
+	}
+
+	if value := os.Getenv(strings.ToUpper(name)); value != "" {
+		return value
+	}
+
+	return dfault
+}
+
+// parseDuration parses an optional duration option. An empty value is a zero
+// duration.
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
 }
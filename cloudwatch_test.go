@@ -1,12 +1,20 @@
 package cloudwatch
 
 import (
+	"fmt"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Pallinder/go-randomdata"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	docker "github.com/fsouza/go-dockerclient"
 	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
 )
 
 const NumMessages = 1000000
@@ -33,6 +41,45 @@ func TestCloudWatchAdapter(t *testing.T) {
 	close(messages)
 }
 
+func BenchmarkAdapterStream(b *testing.B) {
+	mock := test.NewCloudWatchLogsMock()
+	defer mock.Close()
+	mock.DiscardEvents = true
+	mock.AddGroup("group")
+
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	route := &router.Route{Address: "group", Options: map[string]string{"stream": "stream"}}
+	adapter, err := NewAdapterWithConfig(route, AdapterConfig{
+		AWS: aws.NewConfig().
+			WithCredentials(creds).
+			WithEndpoint(mock.URL).
+			WithRegion(REGION).
+			WithDisableSSL(true),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	container := &docker.Container{ID: "web", Name: "/web", Config: &docker.Config{}}
+	messages := make(chan *router.Message)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		adapter.Stream(messages)
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		messages <- &router.Message{Container: container, Source: "stdout", Data: "GET /health 200 1.2ms", Time: time.Now()}
+	}
+
+	close(messages)
+	<-done
+}
+
 func createMessage() *router.Message {
 	data := ""
 	timestamp := time.Now()
@@ -44,3 +91,419 @@ func createMessage() *router.Message {
 
 	return &router.Message{Data: data, Time: timestamp}
 }
+
+type AdapterSuite struct {
+	mock   *test.CloudWatchLogsMock
+	clock  *test.FakeClock
+	budget *Budget
+}
+
+var _ = Suite(&AdapterSuite{})
+
+func (s *AdapterSuite) SetUpTest(c *C) {
+	s.clock = test.NewFakeClock(time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC))
+	s.mock = test.NewCloudWatchLogsMock()
+	s.mock.Now = s.clock.Now
+	s.mock.AddGroup("group")
+	s.budget = NewBudget()
+}
+
+func (s *AdapterSuite) TearDownTest(c *C) {
+	s.mock.Close()
+}
+
+func (s *AdapterSuite) TestCreatesStaticStreamAtStartup(c *C) {
+	_, err := s.newAdapter(map[string]string{})
+
+	c.Assert(err, IsNil)
+	s.mock.AssertCalls(c, "CreateLogStream", 1)
+	c.Assert(s.mock.GetStream("group", "host"), NotNil)
+}
+
+func (s *AdapterSuite) TestRejectsInvalidOptions(c *C) {
+	_, err := s.newAdapter(map[string]string{"format": "xml"})
+
+	c.Assert(err, ErrorMatches, "invalid format: xml")
+}
+
+func (s *AdapterSuite) TestTrimsSources(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"sources": "stdout, stderr"})
+
+	c.Assert(err, IsNil)
+	c.Assert(adapter.sources, DeepEquals, []string{"stdout", "stderr"})
+}
+
+func (s *AdapterSuite) TestRejectsInvalidSources(c *C) {
+	_, err := s.newAdapter(map[string]string{"sources": "stdout,stdin"})
+
+	c.Assert(err, ErrorMatches, "invalid source: stdin")
+}
+
+func (s *AdapterSuite) TestRejectsMaxLatencyBelowBatchDuration(c *C) {
+	_, err := s.newAdapter(map[string]string{"batch_max_latency": "100ms"})
+
+	c.Assert(err, ErrorMatches, "invalid batch max latency: 100ms")
+}
+
+func (s *AdapterSuite) TestLimitsRequestRateOfAStream(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream"})
+	c.Assert(err, IsNil)
+	adapter.capacity = Capacity{Size: batchSize, Length: 1, Payload: true}
+
+	h := s.stream(adapter)
+	for i := 0; i <= streamRequestBurst; i++ {
+		h.send("web", fmt.Sprintf("GET /%d", i))
+	}
+	c.Assert(h.waitForEvents("stream", streamRequestBurst), Equals, true)
+
+	// Logs keep flowing while the upload over the burst waits.
+	h.send("web", "GET /late")
+	s.clock.WaitForWaiters(1, time.Second)
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(s.mock.GetEvents("group", "stream"), HasLen, streamRequestBurst)
+
+	h.idle(streamRequestInterval, 1)
+	c.Assert(h.waitForEvents("stream", streamRequestBurst+1), Equals, true)
+	h.stopThrottled(1)
+
+	s.mock.AssertCalls(c, "PutLogEvents", streamRequestBurst+2)
+}
+
+func (s *AdapterSuite) TestReservesRequestsFromTokenBucket(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream"})
+	c.Assert(err, IsNil)
+	entry := &streamEntry{}
+
+	for i := 0; i < streamRequestBurst; i++ {
+		c.Assert(adapter.reserve(entry), Equals, time.Duration(0))
+	}
+	c.Assert(adapter.reserve(entry), Equals, streamRequestInterval)
+	c.Assert(adapter.reserve(entry), Equals, 2*streamRequestInterval)
+
+	// The bucket refills at the request rate, after paying back the two
+	// requests reserved beyond the burst.
+	s.clock.Advance(time.Second)
+	for i := 0; i < streamRequestBurst-2; i++ {
+		c.Assert(adapter.reserve(entry), Equals, time.Duration(0))
+	}
+	c.Assert(adapter.reserve(entry), Equals, streamRequestInterval)
+}
+
+func (s *AdapterSuite) TestWidensFlushIntervalForSparseLogs(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream", "batch_max_latency": "1s"})
+	c.Assert(err, IsNil)
+
+	h := s.stream(adapter)
+	h.send("web", "GET /")
+	h.idle(batchDuration, 1)
+	c.Assert(h.waitForEvents("stream", 1), Equals, true)
+
+	h.send("web", "GET /health")
+	h.idle(batchDuration, 1)
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(s.mock.GetEvents("group", "stream"), HasLen, 1)
+
+	h.idle(batchDuration, 1)
+	c.Assert(h.waitForEvents("stream", 2), Equals, true)
+	h.stop()
+
+	s.mock.AssertCalls(c, "PutLogEvents", 2)
+}
+
+func (s *AdapterSuite) TestShipsMessagesFromMultipleContainers(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "{{.Name}}"})
+	c.Assert(err, IsNil)
+
+	h := s.stream(adapter)
+	h.send("web", "GET /")
+	h.send("db", "SELECT 1")
+	h.send("web", "GET /health")
+	h.stop()
+
+	s.mock.AssertEvents(c, "group", "web", "GET /", "GET /health")
+	s.mock.AssertEvents(c, "group", "db", "SELECT 1")
+}
+
+func (s *AdapterSuite) TestSplitsBurstsIntoBatches(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream"})
+	c.Assert(err, IsNil)
+	adapter.capacity = Capacity{Size: batchSize, Length: 100, Payload: true}
+
+	h := s.stream(adapter)
+	h.burst("web", 250)
+	h.stop()
+
+	s.mock.AssertCalls(c, "PutLogEvents", 3)
+	c.Assert(s.mock.GetEvents("group", "stream"), HasLen, 250)
+}
+
+func (s *AdapterSuite) TestCountsEventOverheadInBatchSize(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream"})
+	c.Assert(err, IsNil)
+	adapter.capacity.Duration = 0
+
+	// 10000 events of 90 bytes fit the batch length, but not the request
+	// size once CloudWatch adds 26 bytes to each.
+	h := s.stream(adapter)
+	for i := 0; i < batchLength; i++ {
+		h.send("web", fmt.Sprintf("%090d", i))
+	}
+	h.stop()
+
+	s.mock.AssertCalls(c, "PutLogEvents", 2)
+	c.Assert(s.mock.GetEvents("group", "stream"), HasLen, batchLength)
+}
+
+func (s *AdapterSuite) TestFlushesAfterBatchDuration(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream"})
+	c.Assert(err, IsNil)
+
+	h := s.stream(adapter)
+	h.send("web", "GET /")
+	h.idle(batchDuration, 1)
+
+	c.Assert(h.waitForEvents("stream", 1), Equals, true)
+	h.stop()
+
+	s.mock.AssertCalls(c, "PutLogEvents", 1)
+}
+
+func (s *AdapterSuite) TestClosesIdleDestinations(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "{{.Name}}"})
+	c.Assert(err, IsNil)
+	adapter.capacity = Capacity{Size: batchSize, Length: 1, Payload: true}
+
+	h := s.stream(adapter)
+	h.send("web", "GET /")
+	c.Assert(h.waitForEvents("web", 1), Equals, true)
+
+	h.idle(destinationIdle, 1)
+	c.Assert(waitFor(func() bool {
+		adapter.mutex.Lock()
+		defer adapter.mutex.Unlock()
+		return len(adapter.logstreams) == 0
+	}), Equals, true)
+
+	h.send("web", "GET /health")
+	h.stop()
+
+	s.mock.AssertCalls(c, "DescribeLogStreams", 2)
+	s.mock.AssertEvents(c, "group", "web", "GET /", "GET /health")
+}
+
+func (s *AdapterSuite) TestKeepsStreamsUsedByReopenedDestinations(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "{{.Name}}"})
+	c.Assert(err, IsNil)
+	dest := Destination{Group: "group", Stream: "web"}
+
+	closing := adapter.retainStream(dest)
+	reopened := adapter.retainStream(dest)
+	adapter.releaseStream(dest, closing)
+
+	c.Assert(reopened, Equals, closing)
+	c.Assert(adapter.logstreams[dest], Equals, reopened)
+
+	adapter.releaseStream(dest, reopened)
+
+	c.Assert(adapter.logstreams, HasLen, 0)
+}
+
+func (s *AdapterSuite) TestReportsBufferedBytesWithMemoryLimit(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream", "memory_limit": "10"})
+	c.Assert(err, IsNil)
+
+	c.Assert(adapter.metrics.Budget, Equals, s.budget)
+	c.Assert(adapter.metrics.Hostname, Equals, "host")
+
+	adapter, err = s.newAdapter(map[string]string{"stream": "stream"})
+	c.Assert(err, IsNil)
+
+	c.Assert(adapter.metrics, IsNil)
+}
+
+func (s *AdapterSuite) TestDropsLogsOverMemoryLimit(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream", "memory_limit": "10", "memory_overflow": "drop", "metrics_interval": "0"})
+	c.Assert(err, IsNil)
+
+	h := s.stream(adapter)
+	h.send("web", "GET /a")
+	h.send("web", "GET /b")
+	h.stop()
+
+	s.mock.AssertEvents(c, "group", "stream", "GET /a")
+	c.Assert(adapter.stats.Reset().OverflowedEvents, Equals, int64(1))
+	c.Assert(s.budget.Used(), Equals, int64(0))
+}
+
+func (s *AdapterSuite) TestBlocksLogsOverMemoryLimit(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream", "memory_limit": "10", "metrics_interval": "0"})
+	c.Assert(err, IsNil)
+
+	h := s.stream(adapter)
+	h.send("web", "GET /a")
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		h.send("web", "GET /b")
+	}()
+
+	h.idle(batchDuration, 1)
+	<-sent
+	h.stop()
+
+	s.mock.AssertEvents(c, "group", "stream", "GET /a", "GET /b")
+	s.mock.AssertCalls(c, "PutLogEvents", 2)
+	c.Assert(s.budget.Used(), Equals, int64(0))
+}
+
+func (s *AdapterSuite) TestUploadsHigherPriorityLanesFirst(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream", "priority_rules": "high:level:error;low:level:debug"})
+	c.Assert(err, IsNil)
+	adapter.capacity = Capacity{Size: batchSize, Length: 1, Payload: true}
+
+	// The first upload is held until a batch waits in every lane.
+	holding, held := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	s.mock.OnAccept = func(group, stream string, events []*cloudwatchlogs.OutputLogEvent) {
+		once.Do(func() {
+			close(holding)
+			<-held
+		})
+	}
+
+	h := s.stream(adapter)
+	h.send("web", "INFO: started")
+	<-holding
+	h.send("web", "DEBUG: cache miss")
+	h.send("web", "INFO: ready")
+	h.send("web", "ERROR: failed")
+	time.Sleep(10 * time.Millisecond)
+	close(held)
+	h.stop()
+
+	s.mock.AssertEvents(c, "group", "stream", "INFO: started", "ERROR: failed", "INFO: ready", "DEBUG: cache miss")
+	s.mock.AssertCalls(c, "PutLogEvents", 4)
+}
+
+func (s *AdapterSuite) TestRejectsInvalidPriorityRules(c *C) {
+	_, err := s.newAdapter(map[string]string{"priority_rules": "urgent:level:error"})
+
+	c.Assert(err, ErrorMatches, "invalid priority: urgent")
+}
+
+func (s *AdapterSuite) TestAppliesPipelineStages(c *C) {
+	adapter, err := s.newAdapter(map[string]string{"stream": "stream", "format": "json", "sanitize": "true"})
+	c.Assert(err, IsNil)
+
+	h := s.stream(adapter)
+	h.send("web", "\x1b[31mfailed\x1b[0m")
+	h.send("web", "   ")
+	h.stop()
+
+	s.mock.AssertEvents(c, "group", "stream", `{"message":"failed","source":"stdout"}`)
+}
+
+func (s *AdapterSuite) newAdapter(options map[string]string) (*Adapter, error) {
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	config := aws.NewConfig().
+		WithCredentials(creds).
+		WithEndpoint(s.mock.URL).
+		WithRegion(REGION).
+		WithDisableSSL(true).
+		WithSleepDelay(func(time.Duration) {})
+
+	route := &router.Route{Address: "group", Options: options}
+
+	return NewAdapterWithConfig(route, AdapterConfig{
+		AWS:      config,
+		Hostname: func() (string, error) { return "host", nil },
+		Clock:    s.clock,
+		Budget:   s.budget,
+	})
+}
+
+// harness feeds scripted messages through an adapter's pipeline. Messages are
+// timestamped with a fake clock, which is only advanced by idle periods.
+type harness struct {
+	mock     *test.CloudWatchLogsMock
+	clock    *test.FakeClock
+	messages chan *router.Message
+	done     chan struct{}
+}
+
+func (s *AdapterSuite) stream(adapter *Adapter) *harness {
+	h := &harness{
+		mock:     s.mock,
+		clock:    s.clock,
+		messages: make(chan *router.Message),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(h.done)
+		adapter.Stream(h.messages)
+	}()
+
+	return h
+}
+
+// send sends a message written to stdout by a container.
+func (h *harness) send(name, data string) {
+	container := &docker.Container{ID: name, Name: "/" + name, Config: &docker.Config{}}
+	h.messages <- &router.Message{Container: container, Source: "stdout", Data: data, Time: h.clock.Now()}
+}
+
+// burst sends numbered messages from a container.
+func (h *harness) burst(name string, n int) {
+	for i := 0; i < n; i++ {
+		h.send(name, fmt.Sprintf("line %d", i))
+	}
+}
+
+// idle advances the clock as if no logs were written, once the adapter is
+// waiting on a number of timers.
+func (h *harness) idle(d time.Duration, timers int) {
+	h.clock.WaitForWaiters(timers, time.Second)
+	h.clock.Advance(d)
+}
+
+// stopThrottled closes the message stream and advances the clock for each of
+// a number of uploads that wait for the stream's request rate.
+func (h *harness) stopThrottled(uploads int) {
+	close(h.messages)
+
+	for i := 0; i < uploads; i++ {
+		h.idle(streamRequestInterval, 1)
+	}
+
+	<-h.done
+}
+
+// waitForEvents waits for a stream in the group to hold n events.
+func (h *harness) waitForEvents(stream string, n int) bool {
+	return waitFor(func() bool {
+		return len(h.mock.GetEvents("group", stream)) >= n
+	})
+}
+
+// stop closes the message stream and waits for the adapter to ship every
+// message.
+func (h *harness) stop() {
+	close(h.messages)
+	<-h.done
+}
+
+// waitFor polls a condition that other goroutines make true.
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return false
+}
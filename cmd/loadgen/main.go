@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/bradgignac/logspout-cloudwatch"
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// memoryInterval is how often memory usage is sampled.
+const memoryInterval = 50 * time.Millisecond
+
+func main() {
+	messages := flag.Int("messages", 100000, "number of messages to send")
+	containers := flag.Int("containers", 10, "number of containers the messages come from")
+	sizes := flag.String("sizes", "100:80,1000:15,10000:5", "mix of message sizes in bytes, as size:weight pairs")
+	rate := flag.Int("rate", 0, "messages sent per second, or 0 for as fast as possible")
+	stream := flag.String("stream", "{{.Name}}", "stream name template")
+	tokenless := flag.Bool("tokenless", false, "upload without sequence tokens")
+	serve := flag.Bool("serve", false, "run the fake of CloudWatch Logs used by the other process")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Streams generated logs through the cloudwatch adapter into a fake of CloudWatch Logs and reports throughput, latency, allocations and peak memory. The fake runs in a separate process, so it is not included in the measurements.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *serve {
+		fake(os.Stdin, os.Stdout)
+		return
+	}
+
+	mix, err := parseSizes(*sizes)
+	if err != nil {
+		log.Fatalf("Invalid sizes - error: %v", err)
+	}
+
+	if *containers < 1 {
+		log.Fatalf("Invalid containers - containers: %d", *containers)
+	}
+
+	server, err := startFake()
+	if err != nil {
+		log.Fatalf("Fake failed - error: %v", err)
+	}
+
+	route := &router.Route{
+		Address: "loadgen",
+		Options: map[string]string{
+			"stream":    *stream,
+			"tokenless": strconv.FormatBool(*tokenless),
+		},
+	}
+
+	adapter, err := cloudwatch.NewAdapterWithConfig(route, cloudwatch.AdapterConfig{
+		AWS: aws.NewConfig().
+			WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+			WithEndpoint(server.url).
+			WithRegion("us-east-1").
+			WithDisableSSL(true),
+		Hostname: func() (string, error) { return "loadgen", nil },
+	})
+	if err != nil {
+		log.Fatalf("Adapter failed - error: %v", err)
+	}
+
+	peak := &memory{}
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		peak.sample(done)
+	}()
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	bytes := run(adapter, *messages, *containers, mix, *rate)
+
+	elapsed := time.Since(start)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	close(done)
+	<-sampled
+
+	latencies, err := server.stop()
+	if err != nil {
+		log.Fatalf("Fake failed - error: %v", err)
+	}
+
+	n := float64(*messages)
+	fmt.Printf("messages:    %d from %d containers in %v\n", *messages, *containers, elapsed)
+	fmt.Printf("throughput:  %.0f events/s, %.2f MB/s\n", n/elapsed.Seconds(), float64(bytes)/elapsed.Seconds()/1e6)
+	fmt.Printf("latency:     p50 %v, p90 %v, p99 %v, max %v\n", latencies.percentile(50), latencies.percentile(90), latencies.percentile(99), latencies.percentile(100))
+	fmt.Printf("allocations: %.1f per event, %.0f B per event\n", float64(after.Mallocs-before.Mallocs)/n, float64(after.TotalAlloc-before.TotalAlloc)/n)
+	fmt.Printf("peak memory: heap %.1f MB, sys %.1f MB\n", float64(peak.heap)/1e6, float64(peak.sys)/1e6)
+	fmt.Printf("delivered:   %d events\n", latencies.count())
+}
+
+// run streams messages through the adapter, waiting until every message is
+// shipped, and returns the number of bytes sent.
+func run(adapter *cloudwatch.Adapter, messages, containers int, mix []size, rate int) int {
+	ch := make(chan *router.Message)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		adapter.Stream(ch)
+	}()
+
+	sources := make([]*docker.Container, containers)
+	for i := range sources {
+		name := fmt.Sprintf("container-%d", i)
+		sources[i] = &docker.Container{ID: name, Name: "/" + name, Config: &docker.Config{}}
+	}
+
+	random := rand.New(rand.NewSource(1))
+	start := time.Now()
+	bytes := 0
+
+	for i := 0; i < messages; i++ {
+		if rate > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(i) * time.Second / time.Duration(rate))))
+		}
+
+		data := pick(mix, random)
+		bytes += len(data)
+
+		ch <- &router.Message{
+			Container: sources[i%containers],
+			Source:    "stdout",
+			Data:      data,
+			Time:      time.Now(),
+		}
+	}
+
+	close(ch)
+	<-done
+
+	return bytes
+}
+
+// fake runs the fake of CloudWatch Logs. It writes the fake's URL on the
+// first line of w, then serves until r is closed and writes the histogram of
+// delivery latencies as JSON.
+func fake(r io.Reader, w io.Writer) {
+	mock := test.NewCloudWatchLogsMock()
+	defer mock.Close()
+
+	latencies := &histogram{}
+	mock.DiscardEvents = true
+	mock.OnAccept = latencies.record
+	mock.AddGroup("loadgen")
+
+	fmt.Fprintln(w, mock.URL)
+	io.Copy(ioutil.Discard, r)
+
+	latencies.mutex.Lock()
+	defer latencies.mutex.Unlock()
+
+	if err := json.NewEncoder(w).Encode(latencies); err != nil {
+		log.Fatalf("Fake failed - error: %v", err)
+	}
+}
+
+// fakeProcess is the fake of CloudWatch Logs running in another process.
+type fakeProcess struct {
+	url    string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// startFake runs this program with -serve and waits for the fake's URL.
+func startFake() (*fakeProcess, error) {
+	cmd := exec.Command(os.Args[0], "-serve")
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &fakeProcess{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+
+	line, err := p.stdout.ReadString('\n')
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+	p.url = strings.TrimSpace(line)
+
+	return p, nil
+}
+
+// stop stops the fake and returns the latencies of the events it accepted.
+func (p *fakeProcess) stop() (*histogram, error) {
+	p.stdin.Close()
+
+	latencies := &histogram{}
+	if err := json.NewDecoder(p.stdout).Decode(latencies); err != nil {
+		p.cmd.Process.Kill()
+		return nil, err
+	}
+
+	return latencies, p.cmd.Wait()
+}
+
+// size is a message size and the weight it is picked with.
+type size struct {
+	data   string
+	weight int
+}
+
+func parseSizes(value string) ([]size, error) {
+	mix := []size{}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+
+		n, err := strconv.Atoi(parts[0])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid size: %s", pair)
+		}
+
+		weight := 1
+		if len(parts) == 2 {
+			weight, err = strconv.Atoi(parts[1])
+			if err != nil || weight < 1 {
+				return nil, fmt.Errorf("invalid weight: %s", pair)
+			}
+		}
+
+		mix = append(mix, size{data: strings.Repeat("x", n), weight: weight})
+	}
+
+	if len(mix) == 0 {
+		return nil, errors.New("no sizes")
+	}
+
+	return mix, nil
+}
+
+func pick(mix []size, random *rand.Rand) string {
+	total := 0
+	for _, s := range mix {
+		total += s.weight
+	}
+
+	n := random.Intn(total)
+	for _, s := range mix {
+		if n < s.weight {
+			return s.data
+		}
+		n -= s.weight
+	}
+
+	return mix[len(mix)-1].data
+}
+
+// histogram counts the delivery latency of events in milliseconds, from the
+// time Docker read them to the time the fake accepted them.
+type histogram struct {
+	mutex  sync.Mutex
+	Counts map[int64]int
+	Total  int
+}
+
+func (h *histogram) record(group, stream string, events []*cloudwatchlogs.OutputLogEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.Counts == nil {
+		h.Counts = map[int64]int{}
+	}
+
+	for _, event := range events {
+		h.Counts[aws.Int64Value(event.IngestionTime)-aws.Int64Value(event.Timestamp)]++
+		h.Total++
+	}
+}
+
+func (h *histogram) count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.Total
+}
+
+func (h *histogram) percentile(p int) time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	latencies := make([]int64, 0, len(h.Counts))
+	for latency := range h.Counts {
+		latencies = append(latencies, latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	target := (h.Total*p + 99) / 100
+	seen := 0
+
+	for _, latency := range latencies {
+		seen += h.Counts[latency]
+		if seen >= target {
+			return time.Duration(latency) * time.Millisecond
+		}
+	}
+
+	return 0
+}
+
+// memory tracks the peak memory usage of the process.
+type memory struct {
+	heap uint64
+	sys  uint64
+}
+
+func (m *memory) sample(done <-chan struct{}) {
+	ticker := time.NewTicker(memoryInterval)
+	defer ticker.Stop()
+
+	for {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+
+		if stats.HeapInuse > m.heap {
+			m.heap = stats.HeapInuse
+		}
+		if stats.Sys > m.sys {
+			m.sys = stats.Sys
+		}
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/bradgignac/logspout-cloudwatch"
+	"github.com/gliderlabs/logspout/router"
+)
+
+func main() {
+	remove := flag.Bool("remove", false, "remove files once they are replayed")
+	tokenless := flag.Bool("tokenless", false, "upload without sequence tokens")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-remove] [-tokenless] file...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Replays dead-letter files written by logspout-cloudwatch into CloudWatch.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	route := &router.Route{}
+
+	session, err := cloudwatch.NewSession(route)
+	if err != nil {
+		log.Fatalf("Session failed - error: %v", err)
+	}
+
+	replayer := cloudwatch.NewReplayer(session, *tokenless, cloudwatch.NewServiceConfig(route))
+
+	for _, name := range flag.Args() {
+		if err := replay(replayer, name); err != nil {
+			log.Fatalf("Replay failed - file: %s, error: %v", name, err)
+		}
+
+		log.Infof("Replay succeeded - file: %s", name)
+
+		if *remove {
+			if err := os.Remove(name); err != nil {
+				log.Fatalf("Remove failed - file: %s, error: %v", name, err)
+			}
+		}
+	}
+}
+
+func replay(replayer *cloudwatch.Replayer, name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return replayer.Replay(file)
+}
@@ -0,0 +1,141 @@
+package cloudwatch
+
+import (
+	"time"
+)
+
+func dedupe(in <-chan Log, window time.Duration, clock Clock) <-chan Log {
+	if window <= 0 {
+		return in
+	}
+
+	out := make(chan Log)
+	deduplicator := NewDeduplicator(in, out, window, clock)
+
+	go func() {
+		defer close(out)
+		deduplicator.Start()
+	}()
+
+	return out
+}
+
+// Deduplicator collapses consecutive identical messages from the same
+// container and source into a single message annotated with a repeat count.
+type Deduplicator struct {
+	in  <-chan Log
+	out chan<- Log
+
+	window  time.Duration
+	clock   Clock
+	pending map[string]*repeat
+	timer   <-chan time.Time
+}
+
+type repeat struct {
+	msg      *LogMessage
+	count    int
+	last     time.Time
+	received time.Time
+}
+
+// NewDeduplicator creates a Deduplicator that collapses repeated messages
+// received within the window, as measured by the clock.
+func NewDeduplicator(in <-chan Log, out chan<- Log, window time.Duration, clock Clock) *Deduplicator {
+	return &Deduplicator{in: in, out: out, window: window, clock: clock, pending: map[string]*repeat{}}
+}
+
+// Start begins collapsing messages from the input channel.
+func (d *Deduplicator) Start() {
+loop:
+	for {
+		select {
+		case l, ok := <-d.in:
+			if !ok {
+				break loop
+			}
+
+			msg, ok := l.(*LogMessage)
+			if !ok {
+				d.out <- l
+				continue
+			}
+
+			d.add(msg)
+		case <-d.timer:
+			d.timer = nil
+			d.flushExpired()
+		}
+	}
+
+	for key := range d.pending {
+		d.flush(key)
+	}
+}
+
+func (d *Deduplicator) add(msg *LogMessage) {
+	key := repeatKey(msg)
+
+	if r, ok := d.pending[key]; ok {
+		if r.msg.Data == msg.Data && msg.Time.Sub(r.msg.Time) < d.window {
+			r.count++
+			r.last = msg.Time
+			return
+		}
+
+		d.flush(key)
+	}
+
+	d.pending[key] = &repeat{msg: msg, count: 1, last: msg.Time, received: d.clock.Now()}
+	d.startFlushTimer()
+}
+
+func (d *Deduplicator) flushExpired() {
+	for key, r := range d.pending {
+		if d.clock.Now().Sub(r.received) >= d.window {
+			d.flush(key)
+		}
+	}
+
+	d.startFlushTimer()
+}
+
+func (d *Deduplicator) flush(key string) {
+	r := d.pending[key]
+	delete(d.pending, key)
+
+	if r.count > 1 {
+		r.msg.SetField("repeat_count", r.count)
+		r.msg.SetField("first_timestamp", r.msg.Time.Format(time.RFC3339Nano))
+		r.msg.SetField("last_timestamp", r.last.Format(time.RFC3339Nano))
+	}
+
+	d.out <- r.msg
+}
+
+// startFlushTimer schedules the next flush for when the oldest pending
+// message expires, so that no message is held for longer than the window.
+func (d *Deduplicator) startFlushTimer() {
+	if d.timer != nil || len(d.pending) == 0 {
+		return
+	}
+
+	var oldest time.Time
+	for _, r := range d.pending {
+		if oldest.IsZero() || r.received.Before(oldest) {
+			oldest = r.received
+		}
+	}
+
+	d.timer = d.clock.After(oldest.Add(d.window).Sub(d.clock.Now()))
+}
+
+// repeatKey identifies the container and source of a message, so stdout and
+// stderr lines are collapsed separately and keep their own source.
+func repeatKey(msg *LogMessage) string {
+	if msg.Container == nil {
+		return msg.Source
+	}
+
+	return msg.Container.ID + "/" + msg.Source
+}
@@ -0,0 +1,157 @@
+package cloudwatch
+
+import (
+	"time"
+
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type DedupeSuite struct {
+	in    chan Log
+	out   chan Log
+	clock *test.FakeClock
+}
+
+var _ = Suite(&DedupeSuite{})
+
+func (s *DedupeSuite) SetUpTest(c *C) {
+	s.in = make(chan Log)
+	s.out = make(chan Log, 10)
+	s.clock = test.NewFakeClock(time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC))
+}
+
+func (s *DedupeSuite) message(id, data string, t time.Time) *LogMessage {
+	container := &docker.Container{ID: id}
+	return &LogMessage{Message: &router.Message{Container: container, Source: "stdout", Data: data, Time: t}}
+}
+
+func (s *DedupeSuite) TestCollapsesRepeatedMessages(c *C) {
+	deduplicator := NewDeduplicator(s.in, s.out, time.Minute, s.clock)
+	go deduplicator.Start()
+
+	now := time.Now()
+	s.in <- s.message("a", "polling", now)
+	s.in <- s.message("a", "polling", now.Add(time.Second))
+	s.in <- s.message("a", "polling", now.Add(2*time.Second))
+	s.in <- s.message("a", "done", now.Add(3*time.Second))
+
+	log := (<-s.out).(*LogMessage)
+
+	c.Assert(log.Data, Equals, "polling")
+	c.Assert(log.Fields["repeat_count"], Equals, 3)
+	c.Assert(log.Fields["first_timestamp"], Equals, now.Format(time.RFC3339Nano))
+	c.Assert(log.Fields["last_timestamp"], Equals, now.Add(2*time.Second).Format(time.RFC3339Nano))
+}
+
+func (s *DedupeSuite) TestDoesNotAnnotateSingleMessages(c *C) {
+	deduplicator := NewDeduplicator(s.in, s.out, time.Minute, s.clock)
+	go deduplicator.Start()
+
+	now := time.Now()
+	s.in <- s.message("a", "first", now)
+	s.in <- s.message("a", "second", now)
+
+	log := (<-s.out).(*LogMessage)
+
+	c.Assert(log.Data, Equals, "first")
+	c.Assert(log.Fields, HasLen, 0)
+}
+
+func (s *DedupeSuite) TestTracksContainersSeparately(c *C) {
+	deduplicator := NewDeduplicator(s.in, s.out, time.Minute, s.clock)
+	go deduplicator.Start()
+
+	now := time.Now()
+	s.in <- s.message("a", "polling", now)
+	s.in <- s.message("b", "polling", now)
+	s.in <- s.message("a", "polling", now)
+	close(s.in)
+
+	first := (<-s.out).(*LogMessage)
+	second := (<-s.out).(*LogMessage)
+	counts := map[string]interface{}{
+		first.Container.ID:  first.Fields["repeat_count"],
+		second.Container.ID: second.Fields["repeat_count"],
+	}
+
+	c.Assert(counts["a"], Equals, 2)
+	c.Assert(counts["b"], IsNil)
+}
+
+func (s *DedupeSuite) TestTracksSourcesSeparately(c *C) {
+	deduplicator := NewDeduplicator(s.in, s.out, time.Minute, s.clock)
+	go deduplicator.Start()
+
+	now := time.Now()
+	stderr := s.message("a", "polling", now)
+	stderr.Source = "stderr"
+
+	s.in <- s.message("a", "polling", now)
+	s.in <- stderr
+	close(s.in)
+
+	first := (<-s.out).(*LogMessage)
+	second := (<-s.out).(*LogMessage)
+	counts := map[string]interface{}{
+		first.Source:  first.Fields["repeat_count"],
+		second.Source: second.Fields["repeat_count"],
+	}
+
+	c.Assert(counts, DeepEquals, map[string]interface{}{"stdout": nil, "stderr": nil})
+}
+
+func (s *DedupeSuite) TestStartsNewEventAfterWindow(c *C) {
+	deduplicator := NewDeduplicator(s.in, s.out, time.Second, s.clock)
+	go deduplicator.Start()
+
+	now := time.Now()
+	s.in <- s.message("a", "polling", now)
+	s.in <- s.message("a", "polling", now.Add(2*time.Second))
+
+	log := (<-s.out).(*LogMessage)
+
+	c.Assert(log.Fields, HasLen, 0)
+}
+
+func (s *DedupeSuite) TestFlushesWhenWindowElapses(c *C) {
+	deduplicator := NewDeduplicator(s.in, s.out, time.Minute, s.clock)
+	go deduplicator.Start()
+
+	s.in <- s.message("a", "polling", s.clock.Now())
+	c.Assert(s.clock.WaitForWaiters(1, time.Second), Equals, true)
+	c.Assert(s.out, HasLen, 0)
+
+	s.clock.Advance(time.Minute)
+
+	select {
+	case log := <-s.out:
+		c.Assert(log.Body(), Equals, "polling")
+	case <-time.After(time.Second):
+		c.Fatal("message was not flushed")
+	}
+}
+
+func (s *DedupeSuite) TestFlushesEachMessageWhenItsWindowExpires(c *C) {
+	deduplicator := NewDeduplicator(s.in, s.out, time.Second, s.clock)
+	go deduplicator.Start()
+
+	s.in <- s.message("a", "polling", s.clock.Now())
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(500 * time.Millisecond)
+	s.in <- s.message("b", "polling", s.clock.Now())
+	// The repeat is only received once the first message has been added.
+	s.in <- s.message("b", "polling", s.clock.Now())
+
+	s.clock.Advance(500 * time.Millisecond)
+	first := (<-s.out).(*LogMessage)
+	c.Assert(first.Container.ID, Equals, "a")
+
+	s.clock.WaitForWaiters(1, time.Second)
+	s.clock.Advance(500 * time.Millisecond)
+	second := (<-s.out).(*LogMessage)
+	c.Assert(second.Container.ID, Equals, "b")
+	c.Assert(second.Fields["repeat_count"], Equals, 2)
+}
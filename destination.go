@@ -0,0 +1,171 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// rotations map stream rotation periods to the layout of the suffix added to
+// stream names.
+var rotations = map[string]string{
+	"hourly": "2006-01-02-15",
+	"daily":  "2006-01-02",
+}
+
+// Destination identifies the log group and stream a log is sent to.
+type Destination struct {
+	Group  string
+	Stream string
+}
+
+// Namer renders the destination of a log from group and stream name
+// templates.
+type Namer struct {
+	hostname     string
+	group        *template.Template
+	stream       *template.Template
+	stderrStream *template.Template
+	rotation     string
+	static       bool
+}
+
+// nameData is available to group and stream name templates.
+type nameData struct {
+	Hostname string
+	Source   string
+	ID       string
+	Name     string
+	Image    string
+	Labels   map[string]string
+}
+
+// NewNamer creates a Namer from group and stream name templates. Logs from
+// stderr are sent to stderrStream when it is set. When rotation is hourly or
+// daily, the period of each log's timestamp is appended to its stream name.
+func NewNamer(group, stream, stderrStream, rotation, hostname string) (*Namer, error) {
+	namer := &Namer{hostname: hostname}
+	namer.static = !strings.Contains(group+stream, "{{") && stderrStream == "" && rotation == ""
+
+	if rotation != "" {
+		layout, ok := rotations[rotation]
+		if !ok {
+			return nil, fmt.Errorf("invalid stream rotation: %s", rotation)
+		}
+		namer.rotation = layout
+	}
+
+	var err error
+
+	if namer.group, err = parse("group", group); err != nil {
+		return nil, err
+	}
+
+	if namer.stream, err = parse("stream", stream); err != nil {
+		return nil, err
+	}
+
+	if stderrStream != "" {
+		if namer.stderrStream, err = parse("stderr_stream", stderrStream); err != nil {
+			return nil, err
+		}
+	}
+
+	return namer, nil
+}
+
+// Static reports whether every log is sent to the same destination.
+func (n *Namer) Static() bool {
+	return n.static
+}
+
+// Destination renders the destination of a log. Statistics events are sent
+// to the host's stream, as they do not belong to a container.
+func (n *Namer) Destination(l Log) (Destination, error) {
+	if _, ok := l.(*statsEvent); ok && !n.static {
+		return n.hostDestination()
+	}
+
+	data := n.data(l)
+
+	stream := n.stream
+	if n.stderrStream != nil && data.Source == "stderr" {
+		stream = n.stderrStream
+	}
+
+	group, err := render(n.group, data)
+	if err != nil {
+		return Destination{}, err
+	}
+
+	name, err := render(stream, data)
+	if err != nil {
+		return Destination{}, err
+	}
+
+	// Streams are rotated by the time of the event rather than the time it is
+	// shipped, so events are never sent to the wrong period.
+	if n.rotation != "" {
+		t := time.Unix(0, l.Timestamp()*int64(time.Millisecond)).UTC()
+		name += "/" + t.Format(n.rotation)
+	}
+
+	if group == "" || name == "" {
+		return Destination{}, fmt.Errorf("empty destination - group: %q, stream: %q", group, name)
+	}
+
+	return Destination{Group: group, Stream: name}, nil
+}
+
+func (n *Namer) hostDestination() (Destination, error) {
+	group, err := render(n.group, &nameData{Hostname: n.hostname})
+	if err != nil {
+		return Destination{}, err
+	}
+
+	if group == "" {
+		return Destination{}, fmt.Errorf("empty destination - group: %q, stream: %q", group, n.hostname)
+	}
+
+	return Destination{Group: group, Stream: n.hostname}, nil
+}
+
+func (n *Namer) data(l Log) *nameData {
+	data := &nameData{Hostname: n.hostname}
+
+	msg, ok := l.(*LogMessage)
+	if !ok {
+		return data
+	}
+
+	data.Source = msg.Source
+	data.Labels = msg.Labels()
+
+	if msg.Container != nil {
+		data.ID = msg.Container.ID
+		data.Name = strings.TrimPrefix(msg.Container.Name, "/")
+
+		if msg.Container.Config != nil {
+			data.Image = msg.Container.Config.Image
+		}
+	}
+
+	return data
+}
+
+// parse parses a name template. Referring to a missing label is an error
+// rather than rendering "<no value>" into the name.
+func parse(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+func render(t *template.Template, data *nameData) (string, error) {
+	var buffer bytes.Buffer
+	if err := t.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
@@ -0,0 +1,120 @@
+package cloudwatch
+
+import (
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type DestinationSuite struct {
+	log *LogMessage
+}
+
+var _ = Suite(&DestinationSuite{})
+
+func (s *DestinationSuite) SetUpTest(c *C) {
+	container := &docker.Container{
+		ID:     "abc123",
+		Name:   "/web",
+		Config: &docker.Config{Image: "nginx", Labels: map[string]string{"team": "platform"}},
+	}
+	s.log = &LogMessage{Message: &router.Message{Container: container, Source: "stdout"}}
+}
+
+func (s *DestinationSuite) TestStaticNames(c *C) {
+	namer, err := NewNamer("group", "host", "", "", "host")
+	dest, _ := namer.Destination(s.log)
+
+	c.Assert(err, IsNil)
+	c.Assert(namer.Static(), Equals, true)
+	c.Assert(dest, Equals, Destination{Group: "group", Stream: "host"})
+}
+
+func (s *DestinationSuite) TestTemplatedNames(c *C) {
+	namer, _ := NewNamer("{{.Labels.team}}", "{{.Hostname}}/{{.Name}}/{{.Source}}", "", "", "host")
+	dest, err := namer.Destination(s.log)
+
+	c.Assert(err, IsNil)
+	c.Assert(namer.Static(), Equals, false)
+	c.Assert(dest, Equals, Destination{Group: "platform", Stream: "host/web/stdout"})
+}
+
+func (s *DestinationSuite) TestStderrStream(c *C) {
+	namer, _ := NewNamer("group", "host", "host-errors", "", "host")
+
+	stdout, _ := namer.Destination(s.log)
+	s.log.Source = "stderr"
+	stderr, _ := namer.Destination(s.log)
+
+	c.Assert(namer.Static(), Equals, false)
+	c.Assert(stdout.Stream, Equals, "host")
+	c.Assert(stderr.Stream, Equals, "host-errors")
+}
+
+func (s *DestinationSuite) TestStatsGoToHostStream(c *C) {
+	namer, _ := NewNamer("group", "{{.Hostname}}/{{.Name}}", "", "", "host")
+	e := &EMF{Hostname: "host"}
+	dest, err := namer.Destination(e.Stats(StatsSnapshot{}, time.Time{}))
+
+	c.Assert(err, IsNil)
+	c.Assert(dest, Equals, Destination{Group: "group", Stream: "host"})
+}
+
+func (s *DestinationSuite) TestLogsWithoutContainers(c *C) {
+	namer, _ := NewNamer("group", "{{.Hostname}}", "", "", "host")
+	dest, err := namer.Destination(&FakeLog{})
+
+	c.Assert(err, IsNil)
+	c.Assert(dest, Equals, Destination{Group: "group", Stream: "host"})
+}
+
+func (s *DestinationSuite) TestRejectsInvalidTemplates(c *C) {
+	_, err := NewNamer("{{.Name", "stream", "", "", "host")
+
+	c.Assert(err, NotNil)
+}
+
+func (s *DestinationSuite) TestRejectsMissingLabels(c *C) {
+	namer, _ := NewNamer("{{.Labels.owner}}", "stream", "", "", "host")
+	_, err := namer.Destination(s.log)
+
+	c.Assert(err, NotNil)
+}
+
+func (s *DestinationSuite) TestRejectsEmptyNames(c *C) {
+	namer, _ := NewNamer("group", `{{index .Labels "owner"}}`, "", "", "host")
+	_, err := namer.Destination(s.log)
+
+	c.Assert(err, ErrorMatches, "empty destination.*")
+}
+
+func (s *DestinationSuite) TestRotatesStreamsByEventTime(c *C) {
+	namer, err := NewNamer("group", "host", "", "daily", "host")
+	c.Assert(err, IsNil)
+	c.Assert(namer.Static(), Equals, false)
+
+	s.log.Time = time.Date(2016, 5, 5, 23, 59, 59, 999000000, time.UTC)
+	before, _ := namer.Destination(s.log)
+	s.log.Time = s.log.Time.Add(time.Millisecond)
+	after, _ := namer.Destination(s.log)
+
+	c.Assert(before.Stream, Equals, "host/2016-05-05")
+	c.Assert(after.Stream, Equals, "host/2016-05-06")
+}
+
+func (s *DestinationSuite) TestRotatesHourly(c *C) {
+	namer, _ := NewNamer("group", "host", "", "hourly", "host")
+
+	s.log.Time = time.Date(2016, 5, 5, 13, 30, 0, 0, time.UTC)
+	dest, _ := namer.Destination(s.log)
+
+	c.Assert(dest.Stream, Equals, "host/2016-05-05-13")
+}
+
+func (s *DestinationSuite) TestRejectsInvalidRotation(c *C) {
+	_, err := NewNamer("group", "host", "", "weekly", "host")
+
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,214 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// emfDimensions are the dimensions that can be attached to metrics.
+var emfDimensions = []string{"container", "image", "host"}
+
+// statsMetrics describe the adapter's own delivery statistics.
+var statsMetrics = []emfMetric{
+	{Name: "DeliveredEvents", Unit: "Count"},
+	{Name: "DeliveredBytes", Unit: "Bytes"},
+	{Name: "DeliveredBatches", Unit: "Count"},
+	{Name: "FailedBatches", Unit: "Count"},
+	{Name: "DroppedEvents", Unit: "Count"},
+	{Name: "OverflowedEvents", Unit: "Count"},
+	{Name: "BufferedBytes", Unit: "Bytes"},
+}
+
+func emf(in <-chan Log, e *EMF) <-chan Log {
+	return pipe(in, emfStep(e))
+}
+
+func emfStep(e *EMF) step {
+	if e == nil {
+		return nil
+	}
+
+	return func(l Log) Log {
+		if msg, ok := l.(*LogMessage); ok {
+			e.Wrap(msg)
+		}
+
+		return l
+	}
+}
+
+// publishStats periodically adds an EMF event with delivery statistics to a
+// stream of logs.
+func publishStats(in <-chan Log, e *EMF, stats *Stats, interval time.Duration, clock Clock) <-chan Log {
+	if e == nil || interval <= 0 {
+		return in
+	}
+
+	out := make(chan Log)
+
+	go func() {
+		defer close(out)
+
+		tick := clock.After(interval)
+
+		for {
+			select {
+			case l, ok := <-in:
+				if !ok {
+					return
+				}
+				out <- l
+			case <-tick:
+				tick = clock.After(interval)
+				out <- e.Stats(stats.Reset(), clock.Now())
+			}
+		}
+	}()
+
+	return out
+}
+
+// EMF wraps JSON log lines that contain metric values in a CloudWatch
+// Embedded Metric Format envelope, so CloudWatch extracts the metrics.
+type EMF struct {
+	Namespace  string
+	Dimensions []string
+	Metrics    []emfMetric
+	Hostname   string
+}
+
+// statsEvent is an EMF event with the adapter's delivery statistics. It does
+// not belong to a container, so it is sent to the host's stream.
+type statsEvent struct {
+	*LogMessage
+}
+
+type emfMetric struct {
+	Name string
+	Unit string `json:",omitempty"`
+}
+
+type emfDirective struct {
+	Namespace  string
+	Dimensions [][]string
+	Metrics    []emfMetric
+}
+
+type emfMetadata struct {
+	Timestamp         int64
+	CloudWatchMetrics []emfDirective
+}
+
+// NewEMF creates an EMF from route options. Dimensions are comma-separated
+// and metrics are comma-separated names with an optional unit, e.g.
+// duration:Milliseconds.
+func NewEMF(namespace, dimensions, metrics, hostname string) (*EMF, error) {
+	e := &EMF{Namespace: namespace, Hostname: hostname}
+
+	if dimensions != "" {
+		for _, d := range strings.Split(dimensions, ",") {
+			d = strings.TrimSpace(d)
+			if !contains(emfDimensions, d) {
+				return nil, fmt.Errorf("invalid EMF dimension: %s", d)
+			}
+			e.Dimensions = append(e.Dimensions, d)
+		}
+	}
+
+	if metrics != "" {
+		for _, m := range strings.Split(metrics, ",") {
+			parts := strings.SplitN(m, ":", 2)
+			metric := emfMetric{Name: strings.TrimSpace(parts[0])}
+			if len(parts) == 2 {
+				metric.Unit = strings.TrimSpace(parts[1])
+			}
+			e.Metrics = append(e.Metrics, metric)
+		}
+	}
+
+	return e, nil
+}
+
+// Wrap adds an EMF envelope to a log when it is a JSON object with at least
+// one numeric metric value. Other logs are left unchanged.
+func (e *EMF) Wrap(msg *LogMessage) {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(msg.Data), &object); err != nil {
+		return
+	}
+
+	var metrics []emfMetric
+	for _, m := range e.Metrics {
+		if _, ok := object[m.Name].(float64); ok {
+			metrics = append(metrics, m)
+		}
+	}
+
+	if len(metrics) == 0 {
+		return
+	}
+
+	// A field the log already has is left alone and used as the dimension
+	// value, so the log's own data is never overwritten.
+	values := e.dimensionValues(msg)
+	for _, d := range e.Dimensions {
+		if _, ok := object[d]; ok {
+			continue
+		}
+		if _, ok := msg.Fields[d]; ok {
+			continue
+		}
+		msg.SetField(d, values[d])
+	}
+
+	msg.SetField("_aws", e.metadata(metrics, e.Dimensions, msg.Timestamp()))
+}
+
+// Stats creates an EMF event that reports the adapter's delivery statistics.
+func (e *EMF) Stats(snapshot StatsSnapshot, now time.Time) Log {
+	msg := &LogMessage{Message: &router.Message{Data: "{}", Time: now}}
+
+	msg.SetField("host", e.Hostname)
+	msg.SetField("DeliveredEvents", snapshot.DeliveredEvents)
+	msg.SetField("DeliveredBytes", snapshot.DeliveredBytes)
+	msg.SetField("DeliveredBatches", snapshot.DeliveredBatches)
+	msg.SetField("FailedBatches", snapshot.FailedBatches)
+	msg.SetField("DroppedEvents", snapshot.DroppedEvents)
+	msg.SetField("OverflowedEvents", snapshot.OverflowedEvents)
+	msg.SetField("BufferedBytes", snapshot.BufferedBytes)
+	msg.SetField("_aws", e.metadata(statsMetrics, []string{"host"}, msg.Timestamp()))
+
+	return &statsEvent{msg}
+}
+
+func (e *EMF) metadata(metrics []emfMetric, dimensions []string, timestamp int64) *emfMetadata {
+	directive := emfDirective{
+		Namespace:  e.Namespace,
+		Dimensions: [][]string{dimensions},
+		Metrics:    metrics,
+	}
+
+	if len(dimensions) == 0 {
+		directive.Dimensions = [][]string{}
+	}
+
+	return &emfMetadata{Timestamp: timestamp, CloudWatchMetrics: []emfDirective{directive}}
+}
+
+func (e *EMF) dimensionValues(msg *LogMessage) map[string]string {
+	values := map[string]string{"host": e.Hostname}
+
+	if msg.Container != nil {
+		values["container"] = strings.TrimPrefix(msg.Container.Name, "/")
+
+		if msg.Container.Config != nil {
+			values["image"] = msg.Container.Config.Image
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,122 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type EMFSuite struct {
+	emf *EMF
+	now time.Time
+}
+
+var _ = Suite(&EMFSuite{})
+
+func (s *EMFSuite) SetUpTest(c *C) {
+	s.emf, _ = NewEMF("app", "container,image,host", "duration:Milliseconds,count", "host1")
+	s.now = time.Unix(1462449600, 0)
+}
+
+func (s *EMFSuite) wrap(data string) map[string]interface{} {
+	container := &docker.Container{Name: "/web", Config: &docker.Config{Image: "nginx"}}
+	msg := &LogMessage{Message: &router.Message{Container: container, Data: data, Time: s.now}}
+	s.emf.Wrap(msg)
+
+	object := map[string]interface{}{}
+	json.Unmarshal([]byte(msg.Body()), &object)
+	return object
+}
+
+func (s *EMFSuite) TestWrapsMetricLines(c *C) {
+	object := s.wrap(`{"duration":12.5,"path":"/"}`)
+	metadata := object["_aws"].(map[string]interface{})
+	directive := metadata["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+
+	c.Assert(object["duration"], Equals, 12.5)
+	c.Assert(object["path"], Equals, "/")
+	c.Assert(object["container"], Equals, "web")
+	c.Assert(object["image"], Equals, "nginx")
+	c.Assert(object["host"], Equals, "host1")
+	c.Assert(metadata["Timestamp"], Equals, float64(1462449600000))
+	c.Assert(directive["Namespace"], Equals, "app")
+	c.Assert(directive["Dimensions"], DeepEquals, []interface{}{[]interface{}{"container", "image", "host"}})
+	c.Assert(directive["Metrics"], DeepEquals, []interface{}{
+		map[string]interface{}{"Name": "duration", "Unit": "Milliseconds"},
+	})
+}
+
+func (s *EMFSuite) TestKeepsExistingDimensionFields(c *C) {
+	object := s.wrap(`{"duration":12.5,"host":"web-1"}`)
+
+	c.Assert(object["host"], Equals, "web-1")
+	c.Assert(object["container"], Equals, "web")
+}
+
+func (s *EMFSuite) TestIgnoresLinesWithoutMetrics(c *C) {
+	object := s.wrap(`{"path":"/"}`)
+
+	c.Assert(object["_aws"], IsNil)
+}
+
+func (s *EMFSuite) TestIgnoresNonNumericMetrics(c *C) {
+	object := s.wrap(`{"count":"many"}`)
+
+	c.Assert(object["_aws"], IsNil)
+}
+
+func (s *EMFSuite) TestIgnoresPlainLines(c *C) {
+	container := &docker.Container{Name: "/web"}
+	msg := &LogMessage{Message: &router.Message{Container: container, Data: "duration=10"}}
+	s.emf.Wrap(msg)
+
+	c.Assert(msg.Body(), Equals, "duration=10")
+}
+
+func (s *EMFSuite) TestRejectsUnknownDimensions(c *C) {
+	_, err := NewEMF("app", "region", "", "host1")
+
+	c.Assert(err, NotNil)
+}
+
+func (s *EMFSuite) TestTrimsNames(c *C) {
+	e, err := NewEMF("app", "container, host", "duration:Milliseconds, bytes", "host1")
+
+	c.Assert(err, IsNil)
+	c.Assert(e.Dimensions, DeepEquals, []string{"container", "host"})
+	c.Assert(e.Metrics, DeepEquals, []emfMetric{{Name: "duration", Unit: "Milliseconds"}, {Name: "bytes"}})
+}
+
+func (s *EMFSuite) TestStatsEvent(c *C) {
+	log := s.emf.Stats(StatsSnapshot{DeliveredEvents: 10, FailedBatches: 1}, s.now)
+
+	object := map[string]interface{}{}
+	json.Unmarshal([]byte(log.Body()), &object)
+	metadata := object["_aws"].(map[string]interface{})
+	directive := metadata["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+
+	c.Assert(object["DeliveredEvents"], Equals, float64(10))
+	c.Assert(object["FailedBatches"], Equals, float64(1))
+	c.Assert(object["host"], Equals, "host1")
+	c.Assert(directive["Dimensions"], DeepEquals, []interface{}{[]interface{}{"host"}})
+	c.Assert(log.Timestamp(), Equals, int64(1462449600000))
+}
+
+func (s *EMFSuite) TestPublishesStats(c *C) {
+	clock := test.NewFakeClock(s.now)
+	input := make(chan Log)
+	output := publishStats(input, s.emf, &Stats{}, time.Minute, clock)
+
+	clock.WaitForWaiters(1, time.Second)
+	clock.Advance(time.Minute)
+
+	log := <-output
+	c.Assert(log.Body(), Matches, `.*"DeliveredEvents":0.*`)
+	c.Assert(log.Timestamp(), Equals, s.now.Add(time.Minute).UnixNano()/int64(time.Millisecond))
+
+	close(input)
+}
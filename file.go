@@ -0,0 +1,92 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// deadLetterName is the name of the file that a FileSink appends to.
+const deadLetterName = "dead-letter.ndjson"
+
+// FileSink appends undelivered events to newline-delimited JSON files in a
+// local directory. Files are rotated once they reach MaxSize, and only the
+// newest MaxFiles rotated files are kept.
+type FileSink struct {
+	Dir      string
+	MaxSize  int64
+	MaxFiles int
+
+	mutex sync.Mutex
+}
+
+// NewFileSink instantiates a FileSink, creating its directory.
+func NewFileSink(dir string, maxSize int64, maxFiles int) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileSink{Dir: dir, MaxSize: maxSize, MaxFiles: maxFiles}, nil
+}
+
+// Write appends a batch to the current dead-letter file.
+func (s *FileSink) Write(dest Destination, events []*cloudwatchlogs.InputLogEvent, reason error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := filepath.Join(s.Dir, deadLetterName)
+
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = encodeRecords(json.NewEncoder(file), dest, events, reason)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.rotate(name)
+}
+
+func (s *FileSink) rotate(name string) error {
+	info, err := os.Stat(name)
+	if err != nil || s.MaxSize <= 0 || info.Size() < s.MaxSize {
+		return err
+	}
+
+	rotated := filepath.Join(s.Dir, fmt.Sprintf("dead-letter-%d.ndjson", time.Now().UnixNano()))
+	if err := os.Rename(name, rotated); err != nil {
+		return err
+	}
+
+	return s.prune()
+}
+
+func (s *FileSink) prune() error {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "dead-letter-*.ndjson"))
+	if err != nil || s.MaxFiles <= 0 || len(files) <= s.MaxFiles {
+		return err
+	}
+
+	// Rotated files are named by time, so they sort oldest first.
+	sort.Strings(files)
+
+	for _, file := range files[:len(files)-s.MaxFiles] {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package cloudwatch
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	. "gopkg.in/check.v1"
+)
+
+type FileSuite struct {
+	dir    string
+	events []*cloudwatchlogs.InputLogEvent
+}
+
+var _ = Suite(&FileSuite{})
+
+func (s *FileSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.events = []*cloudwatchlogs.InputLogEvent{
+		{Message: aws.String("one"), Timestamp: aws.Int64(1000)},
+		{Message: aws.String("two"), Timestamp: aws.Int64(2000)},
+	}
+}
+
+func (s *FileSuite) TestAppendsRecords(c *C) {
+	sink, err := NewFileSink(filepath.Join(s.dir, "dead"), 0, 0)
+	c.Assert(err, IsNil)
+
+	dest := Destination{Group: "group", Stream: "stream"}
+	c.Assert(sink.Write(dest, s.events, errors.New("denied")), IsNil)
+	c.Assert(sink.Write(dest, s.events[:1], errors.New("denied")), IsNil)
+
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "dead", deadLetterName))
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	c.Assert(err, IsNil)
+	c.Assert(lines, HasLen, 3)
+	c.Assert(lines[0], Equals, `{"group":"group","stream":"stream","timestamp":1000,"message":"one","reason":"denied"}`)
+}
+
+func (s *FileSuite) TestRotatesAndPrunesFiles(c *C) {
+	sink, _ := NewFileSink(s.dir, 1, 2)
+	dest := Destination{Group: "group", Stream: "stream"}
+
+	for i := 0; i < 4; i++ {
+		c.Assert(sink.Write(dest, s.events, nil), IsNil)
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(s.dir, "dead-letter-*.ndjson"))
+	_, err := os.Stat(filepath.Join(s.dir, deadLetterName))
+
+	c.Assert(rotated, HasLen, 2)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
@@ -1,17 +1,46 @@
 package cloudwatch
 
+import "strings"
+
 func filter(in <-chan Log) <-chan Log {
-	out := make(chan Log)
+	return pipe(in, filterStep)
+}
+
+// filterStep drops logs that consist only of whitespace.
+func filterStep(l Log) Log {
+	if strings.TrimSpace(l.Body()) == "" {
+		return nil
+	}
 
-	go func() {
-		defer close(out)
+	return l
+}
+
+// filterSources drops logs that were not written to one of the given sources
+// (e.g. stdout or stderr).
+func filterSources(in <-chan Log, sources []string) <-chan Log {
+	return pipe(in, sourcesStep(sources))
+}
+
+func sourcesStep(sources []string) step {
+	if len(sources) == 0 {
+		return nil
+	}
+
+	return func(l Log) Log {
+		if msg, ok := l.(*LogMessage); ok && !contains(sources, msg.Source) {
+			return nil
+		}
+
+		return l
+	}
+}
 
-		for log := range in {
-			if log.Body() != "" {
-				out <- log
-			}
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
-	}()
+	}
 
-	return out
+	return false
 }
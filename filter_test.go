@@ -19,10 +19,59 @@ func (s *FilterSuite) TestFiltersEmptyMessages(c *C) {
 	input := make(chan Log, 1)
 	output := filter(input)
 
-	input <- &LogMessage{&router.Message{Data: ""}}
-	input <- &LogMessage{&router.Message{Data: "valid"}}
+	input <- &LogMessage{Message: &router.Message{Data: ""}}
+	input <- &LogMessage{Message: &router.Message{Data: "valid"}}
 	log := <-output
 
 	c.Assert(output, HasLen, 0)
 	c.Assert(log.Body(), Equals, "valid")
 }
+
+func (s *FilterSuite) TestFiltersWhitespaceMessages(c *C) {
+	input := make(chan Log, 1)
+	output := filter(input)
+
+	input <- &LogMessage{Message: &router.Message{Data: " \t\n"}}
+	input <- &LogMessage{Message: &router.Message{Data: "valid"}}
+	log := <-output
+
+	c.Assert(output, HasLen, 0)
+	c.Assert(log.Body(), Equals, "valid")
+}
+
+func (s *FilterSuite) TestFiltersSources(c *C) {
+	input := make(chan Log, 1)
+	output := filterSources(input, []string{"stderr"})
+
+	input <- &LogMessage{Message: &router.Message{Data: "out", Source: "stdout"}}
+	input <- &LogMessage{Message: &router.Message{Data: "err", Source: "stderr"}}
+	log := <-output
+
+	c.Assert(output, HasLen, 0)
+	c.Assert(log.Body(), Equals, "err")
+}
+
+func (s *FilterSuite) TestKeepsAllSourcesByDefault(c *C) {
+	input := make(chan Log)
+	output := filterSources(input, nil)
+
+	c.Assert(output, Equals, (<-chan Log)(input))
+}
+
+func BenchmarkFilter(b *testing.B) {
+	input := make(chan Log)
+	output := filter(input)
+	log := &LogMessage{Message: &router.Message{Data: "GET /health 200 1.2ms"}}
+
+	b.ReportAllocs()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			input <- log
+		}
+		close(input)
+	}()
+
+	for range output {
+	}
+}
@@ -0,0 +1,129 @@
+package cloudwatch
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Set batch sizes based on Firehose PutRecordBatch limits. While the actual
+// size limit is 4 MiB, we leave room for the newline added to each record.
+const firehoseBatchSize = 4000000
+const firehoseBatchLength = 500
+
+func init() {
+	router.AdapterFactories.Register(NewFirehoseAdapter, "firehose")
+}
+
+// FirehoseAdapter ships logs to an Amazon Kinesis Data Firehose delivery
+// stream.
+type FirehoseAdapter struct {
+	route    *router.Route
+	stream   *FirehoseStream
+	capacity Capacity
+}
+
+// NewFirehoseAdapter instances a new Firehose adapter.
+func NewFirehoseAdapter(route *router.Route) (router.LogAdapter, error) {
+	session, err := NewSession(route)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := NewFirehoseStream(session, route.Address, NewServiceConfig(route))
+
+	capacity := Capacity{
+		Size:     firehoseBatchSize,
+		Length:   firehoseBatchLength,
+		Duration: batchDuration,
+	}
+
+	log.Infof("Created Firehose adapter - stream: %s", route.Address)
+
+	return &FirehoseAdapter{route: route, stream: stream, capacity: capacity}, nil
+}
+
+// Stream passes messages from a logspout message channel to Firehose.
+func (a *FirehoseAdapter) Stream(logstream chan *router.Message) {
+	log.Infof("Firehose adapter is streaming Docker logs")
+
+	logs := filter(transform(logstream))
+	batches := batch(logs, a.capacity)
+
+	for batch := range batches {
+		a.stream.Put(batch.Logs)
+		releaseBatch(batch)
+	}
+}
+
+// FirehoseStream ships logs to a Firehose delivery stream.
+type FirehoseStream struct {
+	Name    *string
+	service *firehose.Firehose
+	clock   Clock
+}
+
+// NewFirehoseStream instantiates a FirehoseStream.
+func NewFirehoseStream(session *session.Session, name string, configs ...*aws.Config) *FirehoseStream {
+	return &FirehoseStream{
+		Name:    aws.String(name),
+		service: firehose.New(session, configs...),
+		clock:   realClock{},
+	}
+}
+
+// Put submits a batch of logs to the delivery stream as newline-delimited
+// records, retrying records that fail.
+func (s *FirehoseStream) Put(logs []Log) error {
+	records := make([]*firehose.Record, len(logs))
+	for i, l := range logs {
+		records[i] = &firehose.Record{Data: []byte(l.Body() + "\n")}
+	}
+
+	err := retryRecords(len(records), s.clock, func(indexes []int) ([]int, error) {
+		return s.put(records, indexes)
+	})
+
+	if err != nil {
+		log.Errorf("Firehose upload failed - length: %d, error: %v", len(logs), err)
+		return err
+	}
+
+	log.Debugf("Firehose upload succeeded - length: %d", len(logs))
+
+	return nil
+}
+
+func (s *FirehoseStream) put(records []*firehose.Record, indexes []int) ([]int, error) {
+	params := &firehose.PutRecordBatchInput{
+		DeliveryStreamName: s.Name,
+		Records:            make([]*firehose.Record, len(indexes)),
+	}
+
+	for i, index := range indexes {
+		params.Records[i] = records[index]
+	}
+
+	resp, err := s.service.PutRecordBatch(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.Int64Value(resp.FailedPutCount) == 0 {
+		return nil, nil
+	}
+
+	var failed []int
+	for i, entry := range resp.RequestResponses {
+		if entry.ErrorCode != nil {
+			failed = append(failed, indexes[i])
+		}
+	}
+
+	log.Infof("Retrying failed Firehose records - length: %d", len(failed))
+
+	return failed, nil
+}
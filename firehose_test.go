@@ -0,0 +1,79 @@
+package cloudwatch
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type FirehoseSuite struct {
+	mock   *test.FirehoseMock
+	clock  *test.FakeClock
+	stream *FirehoseStream
+}
+
+var _ = Suite(&FirehoseSuite{})
+
+func (s *FirehoseSuite) SetUpTest(c *C) {
+	s.mock = test.NewFirehoseMock()
+	s.clock = test.NewFakeClock(time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC))
+
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	config := aws.NewConfig().
+		WithCredentials(creds).
+		WithEndpoint(s.mock.URL).
+		WithRegion(REGION).
+		WithDisableSSL(true)
+	session := session.New(config)
+
+	s.stream = &FirehoseStream{
+		Name:    aws.String("delivery"),
+		service: firehose.New(session),
+		clock:   s.clock,
+	}
+}
+
+func (s *FirehoseSuite) TearDownTest(c *C) {
+	s.mock.Close()
+}
+
+func (s *FirehoseSuite) logs(bodies ...string) []Log {
+	logs := make([]Log, len(bodies))
+	for i, body := range bodies {
+		logs[i] = &LogMessage{Message: &router.Message{Data: body}}
+	}
+	return logs
+}
+
+func (s *FirehoseSuite) TestPutsNewlineDelimitedRecords(c *C) {
+	err := s.stream.Put(s.logs("one", "two"))
+	records := s.mock.GetRecords("delivery")
+
+	c.Assert(err, IsNil)
+	c.Assert(records, DeepEquals, [][]byte{[]byte("one\n"), []byte("two\n")})
+}
+
+func (s *FirehoseSuite) TestRetriesFailedRecords(c *C) {
+	s.mock.FailRecords = 1
+
+	err := backingOff(s.clock, func() error { return s.stream.Put(s.logs("one", "two")) })
+	records := s.mock.GetRecords("delivery")
+
+	c.Assert(err, IsNil)
+	c.Assert(records, DeepEquals, [][]byte{[]byte("two\n"), []byte("one\n")})
+}
+
+func (s *FirehoseSuite) TestFailsWhenRetriesExhausted(c *C) {
+	s.mock.FailRecords = recordAttempts
+
+	err := backingOff(s.clock, func() error { return s.stream.Put(s.logs("one")) })
+
+	c.Assert(err, NotNil)
+	c.Assert(s.mock.GetRecords("delivery"), HasLen, 0)
+}
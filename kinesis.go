@@ -0,0 +1,150 @@
+package cloudwatch
+
+import (
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Set batch sizes based on Kinesis PutRecords limits. While the actual size
+// limit is 5 MiB, we leave room for the partition key of each record.
+const kinesisBatchSize = 5000000
+const kinesisBatchLength = 500
+
+func init() {
+	router.AdapterFactories.Register(NewKinesisAdapter, "kinesis")
+}
+
+// KinesisAdapter ships logs to an Amazon Kinesis data stream.
+type KinesisAdapter struct {
+	route    *router.Route
+	stream   *KinesisStream
+	capacity Capacity
+}
+
+// NewKinesisAdapter instances a new Kinesis adapter.
+func NewKinesisAdapter(route *router.Route) (router.LogAdapter, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := NewSession(route)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := NewKinesisStream(session, route.Address, hostname, NewServiceConfig(route))
+
+	capacity := Capacity{
+		Size:     kinesisBatchSize,
+		Length:   kinesisBatchLength,
+		Duration: batchDuration,
+	}
+
+	log.Infof("Created Kinesis adapter - stream: %s", route.Address)
+
+	return &KinesisAdapter{route: route, stream: stream, capacity: capacity}, nil
+}
+
+// Stream passes messages from a logspout message channel to Kinesis.
+func (a *KinesisAdapter) Stream(logstream chan *router.Message) {
+	log.Infof("Kinesis adapter is streaming Docker logs")
+
+	logs := filter(transform(logstream))
+	batches := batch(logs, a.capacity)
+
+	for batch := range batches {
+		a.stream.Put(batch.Logs)
+		releaseBatch(batch)
+	}
+}
+
+// KinesisStream ships logs to a Kinesis data stream. Records are partitioned
+// by container, so each container's logs land on the same shard. Records that
+// fail are retried after the rest of the batch, so a container's logs may
+// arrive out of order.
+type KinesisStream struct {
+	Name     *string
+	Hostname string
+	service  *kinesis.Kinesis
+	clock    Clock
+}
+
+// NewKinesisStream instantiates a KinesisStream.
+func NewKinesisStream(session *session.Session, name, hostname string, configs ...*aws.Config) *KinesisStream {
+	return &KinesisStream{
+		Name:     aws.String(name),
+		Hostname: hostname,
+		service:  kinesis.New(session, configs...),
+		clock:    realClock{},
+	}
+}
+
+// Put submits a batch of logs to the data stream, retrying records that fail.
+func (s *KinesisStream) Put(logs []Log) error {
+	records := make([]*kinesis.PutRecordsRequestEntry, len(logs))
+	for i, l := range logs {
+		records[i] = &kinesis.PutRecordsRequestEntry{
+			Data:         []byte(l.Body()),
+			PartitionKey: aws.String(s.partitionKey(l)),
+		}
+	}
+
+	err := retryRecords(len(records), s.clock, func(indexes []int) ([]int, error) {
+		return s.put(records, indexes)
+	})
+
+	if err != nil {
+		log.Errorf("Kinesis upload failed - length: %d, error: %v", len(logs), err)
+		return err
+	}
+
+	log.Debugf("Kinesis upload succeeded - length: %d", len(logs))
+
+	return nil
+}
+
+func (s *KinesisStream) put(records []*kinesis.PutRecordsRequestEntry, indexes []int) ([]int, error) {
+	params := &kinesis.PutRecordsInput{
+		StreamName: s.Name,
+		Records:    make([]*kinesis.PutRecordsRequestEntry, len(indexes)),
+	}
+
+	for i, index := range indexes {
+		params.Records[i] = records[index]
+	}
+
+	resp, err := s.service.PutRecords(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.Int64Value(resp.FailedRecordCount) == 0 {
+		return nil, nil
+	}
+
+	var failed []int
+	for i, entry := range resp.Records {
+		if entry.ErrorCode != nil {
+			failed = append(failed, indexes[i])
+		}
+	}
+
+	log.Infof("Retrying failed Kinesis records - length: %d", len(failed))
+
+	return failed, nil
+}
+
+func (s *KinesisStream) partitionKey(l Log) string {
+	if msg, ok := l.(*LogMessage); ok && msg.Container != nil {
+		return msg.Container.ID
+	}
+
+	return s.Hostname
+}
@@ -0,0 +1,82 @@
+package cloudwatch
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type KinesisSuite struct {
+	mock   *test.KinesisMock
+	clock  *test.FakeClock
+	stream *KinesisStream
+}
+
+var _ = Suite(&KinesisSuite{})
+
+func (s *KinesisSuite) SetUpTest(c *C) {
+	s.mock = test.NewKinesisMock()
+	s.clock = test.NewFakeClock(time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC))
+
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	config := aws.NewConfig().
+		WithCredentials(creds).
+		WithEndpoint(s.mock.URL).
+		WithRegion(REGION).
+		WithDisableSSL(true)
+	session := session.New(config)
+
+	s.stream = &KinesisStream{
+		Name:     aws.String("stream"),
+		Hostname: "host",
+		service:  kinesis.New(session),
+		clock:    s.clock,
+	}
+}
+
+func (s *KinesisSuite) TearDownTest(c *C) {
+	s.mock.Close()
+}
+
+func (s *KinesisSuite) TestPutsRecordsPartitionedByContainer(c *C) {
+	container := &docker.Container{ID: "abc123"}
+	logs := []Log{
+		&LogMessage{Message: &router.Message{Container: container, Data: "one"}},
+		&LogMessage{Message: &router.Message{Data: "two"}},
+	}
+
+	err := s.stream.Put(logs)
+	records := s.mock.GetRecords("stream")
+
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(string(records[0].Data), Equals, "one")
+	c.Assert(records[0].PartitionKey, Equals, "abc123")
+	c.Assert(string(records[1].Data), Equals, "two")
+	c.Assert(records[1].PartitionKey, Equals, "host")
+}
+
+func (s *KinesisSuite) TestRetriesFailedRecords(c *C) {
+	s.mock.FailRecords = 2
+	logs := []Log{
+		&LogMessage{Message: &router.Message{Data: "one"}},
+		&LogMessage{Message: &router.Message{Data: "two"}},
+		&LogMessage{Message: &router.Message{Data: "three"}},
+	}
+
+	err := backingOff(s.clock, func() error { return s.stream.Put(logs) })
+	records := s.mock.GetRecords("stream")
+
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 3)
+	c.Assert(string(records[0].Data), Equals, "three")
+	c.Assert(string(records[1].Data), Equals, "one")
+	c.Assert(string(records[2].Data), Equals, "two")
+}
@@ -1,6 +1,8 @@
 package cloudwatch
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/gliderlabs/logspout/router"
@@ -15,25 +17,104 @@ type Log interface {
 // LogMessage represents a log message to be sent to CloudWatch.
 type LogMessage struct {
 	*router.Message
+
+	// Fields are attached to the message when it is sent to CloudWatch. A
+	// message with fields is sent as a JSON object. Fields are set with
+	// SetField, so the rendered body can be cached.
+	Fields map[string]interface{}
+
+	// EventTime overrides the time Docker read the message, e.g. when the
+	// timestamp is extracted from the message itself.
+	EventTime time.Time
+
+	// body caches the structured body until a field changes.
+	body string
 }
 
 // Body returns a string representation of the log.
 func (l *LogMessage) Body() string {
-	return l.Data
+	if len(l.Fields) == 0 {
+		return l.Data
+	}
+
+	if l.body == "" {
+		l.body = l.structuredBody()
+	}
+
+	return l.body
 }
 
 // Size returns the size of the log message in bytes.
 func (l *LogMessage) Size() int {
-	return len(l.Data)
+	return len(l.Body())
 }
 
 // Timestamp returns the number of milliseconds since the epoch.
 func (l *LogMessage) Timestamp() int64 {
+	if !l.EventTime.IsZero() {
+		return l.EventTime.UnixNano() / int64(time.Millisecond)
+	}
+
 	return l.Time.UnixNano() / int64(time.Millisecond)
 }
 
+// SetField attaches a field to the structured representation of the log.
+func (l *LogMessage) SetField(key string, value interface{}) {
+	if l.Fields == nil {
+		l.Fields = map[string]interface{}{}
+	}
+
+	l.Fields[key] = value
+	l.body = ""
+}
+
+// Labels returns the labels of the container that emitted the log.
+func (l *LogMessage) Labels() map[string]string {
+	if l.Container == nil || l.Container.Config == nil {
+		return nil
+	}
+
+	return l.Container.Config.Labels
+}
+
+// structuredBody merges fields into messages that are already JSON objects
+// and wraps all other messages in an object with a message field. Numbers
+// are kept as written, so large integer IDs do not lose precision.
+func (l *LogMessage) structuredBody() string {
+	object := decodeObject(l.Data)
+	if object == nil {
+		object = map[string]interface{}{"message": l.Data}
+	}
+
+	for k, v := range l.Fields {
+		object[k] = v
+	}
+
+	body, err := json.Marshal(object)
+	if err != nil {
+		return l.Data
+	}
+
+	return string(body)
+}
+
+// decodeObject decodes a message that is a single JSON object, or returns
+// nil.
+func decodeObject(data string) map[string]interface{} {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || decoder.More() {
+		return nil
+	}
+
+	return object
+}
+
 type FakeLog struct {
-	size int
+	size      int
+	timestamp int64
 }
 
 func (l *FakeLog) Body() string {
@@ -45,5 +126,5 @@ func (l *FakeLog) Size() int {
 }
 
 func (l *FakeLog) Timestamp() int64 {
-	return 0
+	return l.timestamp
 }
@@ -25,7 +25,7 @@ func (s *LogSuite) TestSize(c *C) {
 	}
 
 	msg := &router.Message{Data: buffer.String()}
-	log := LogMessage{msg}
+	log := LogMessage{Message: msg}
 
 	c.Assert(log.Size(), Equals, 2048)
 }
@@ -33,7 +33,59 @@ func (s *LogSuite) TestSize(c *C) {
 func (s *LogSuite) TestTimestamp(c *C) {
 	now := time.Now()
 	msg := &router.Message{Time: now}
-	log := LogMessage{msg}
+	log := LogMessage{Message: msg}
 
 	c.Assert(log.Timestamp(), Equals, now.UnixNano()/int64(time.Millisecond))
 }
+
+func (s *LogSuite) TestBodyWithFields(c *C) {
+	msg := &router.Message{Data: "hello"}
+	log := LogMessage{Message: msg}
+	log.SetField("sample_rate", 10)
+
+	c.Assert(log.Body(), Equals, `{"message":"hello","sample_rate":10}`)
+	c.Assert(log.Size(), Equals, len(log.Body()))
+}
+
+func (s *LogSuite) TestBodyWithFieldsMergesJSON(c *C) {
+	msg := &router.Message{Data: `{"level":"info"}`}
+	log := LogMessage{Message: msg}
+	log.SetField("sample_rate", 10)
+
+	c.Assert(log.Body(), Equals, `{"level":"info","sample_rate":10}`)
+}
+
+func (s *LogSuite) TestTimestampPrefersEventTime(c *C) {
+	now := time.Now()
+	msg := &router.Message{Time: now}
+	log := LogMessage{Message: msg, EventTime: now.Add(-time.Minute)}
+
+	c.Assert(log.Timestamp(), Equals, now.Add(-time.Minute).UnixNano()/int64(time.Millisecond))
+}
+
+func (s *LogSuite) TestBodyWithFieldsKeepsLargeNumbers(c *C) {
+	msg := &router.Message{Data: `{"id":9007199254740993,"ratio":0.25}`}
+	log := LogMessage{Message: msg}
+	log.SetField("sample_rate", 10)
+
+	c.Assert(log.Body(), Equals, `{"id":9007199254740993,"ratio":0.25,"sample_rate":10}`)
+}
+
+func (s *LogSuite) TestBodyWithFieldsWrapsTrailingData(c *C) {
+	msg := &router.Message{Data: `{"level":"info"} trailing`}
+	log := LogMessage{Message: msg}
+	log.SetField("sample_rate", 10)
+
+	c.Assert(log.Body(), Equals, `{"message":"{\"level\":\"info\"} trailing","sample_rate":10}`)
+}
+
+func (s *LogSuite) TestBodyIsRenderedAgainWhenFieldsChange(c *C) {
+	msg := &router.Message{Data: "hello"}
+	log := LogMessage{Message: msg}
+	log.SetField("sample_rate", 10)
+	c.Assert(log.Body(), Equals, `{"message":"hello","sample_rate":10}`)
+
+	log.SetField("source", "stdout")
+
+	c.Assert(log.Body(), Equals, `{"message":"hello","sample_rate":10,"source":"stdout"}`)
+}
@@ -5,16 +5,19 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 )
 
-// LogStream ships logs to AWS CloudWatch.
+// LogStream ships logs to AWS CloudWatch. In tokenless mode, uploads omit the
+// sequence token, so Log can be called concurrently.
 type LogStream struct {
-	Group   *string
-	Stream  *string
-	Token   *string
-	service *cloudwatchlogs.CloudWatchLogs
+	Group     *string
+	Stream    *string
+	Token     *string
+	Tokenless bool
+	service   *cloudwatchlogs.CloudWatchLogs
 }
 
 func filterStreams(vs []*cloudwatchlogs.LogStream, f func(*cloudwatchlogs.LogStream) bool) []*cloudwatchlogs.LogStream {
@@ -27,14 +30,15 @@ func filterStreams(vs []*cloudwatchlogs.LogStream, f func(*cloudwatchlogs.LogStr
 	return vsf
 }
 
-// NewLogStream instantiates a Logger.
-func NewLogStream(group, stream string) (*LogStream, error) {
-	session := session.New()
-	cloudwatch := cloudwatchlogs.New(session)
+// NewLogStream instantiates a Logger. The configs are applied to its
+// CloudWatch Logs client.
+func NewLogStream(session *session.Session, group, stream string, tokenless bool, configs ...*aws.Config) (*LogStream, error) {
+	cloudwatch := cloudwatchlogs.New(session, configs...)
 	logstream := &LogStream{
-		Group:   aws.String(group),
-		Stream:  aws.String(stream),
-		service: cloudwatch,
+		Group:     aws.String(group),
+		Stream:    aws.String(stream),
+		Tokenless: tokenless,
+		service:   cloudwatch,
 	}
 	err := logstream.Init()
 
@@ -49,7 +53,9 @@ func (s *LogStream) Init() error {
 	}
 
 	if stream != nil {
-		s.Token = stream.UploadSequenceToken
+		if !s.Tokenless {
+			s.Token = stream.UploadSequenceToken
+		}
 		return nil
 	}
 
@@ -96,17 +102,39 @@ func (s *LogStream) Log(logs []*cloudwatchlogs.InputLogEvent) error {
 		LogEvents:     logs,
 		LogGroupName:  s.Group,
 		LogStreamName: s.Stream,
-		SequenceToken: s.Token,
+	}
+
+	if !s.Tokenless {
+		params.SequenceToken = s.Token
 	}
 
 	resp, err := s.service.PutLogEvents(params)
+
+	// The SDK does not retry requests whose response was lost, as the batch
+	// may have been accepted. With a sequence token, the retry is rejected
+	// if it was.
+	if isRequestError(err) && !s.Tokenless {
+		log.Infof("Retrying log upload after request error - length: %d, error: %v", len(logs), err)
+		resp, err = s.service.PutLogEvents(params)
+	}
+
 	awserr, _ := err.(awserr.Error)
 
 	if awserr != nil {
 		switch awserr.Code() {
 		case "InvalidSequenceTokenException":
+			if s.Tokenless {
+				log.Errorf("Log upload failed - length: %d, error: %v", len(logs), err)
+				return awserr
+			}
+
 			log.Infof("Retrying log upload with new token - length %d, error, %v", len(logs), err)
 			return s.retryBatchWithNewToken(logs)
+		case "DataAlreadyAcceptedException":
+			// A retried request was already accepted before its response
+			// was lost, so only the token needs to be refreshed.
+			log.Infof("Log upload already accepted - length: %d", len(logs))
+			return s.Init()
 		default:
 			log.Errorf("Log upload failed - length: %d, error: %v", len(logs), err)
 			return awserr
@@ -119,7 +147,9 @@ func (s *LogStream) Log(logs []*cloudwatchlogs.InputLogEvent) error {
 		log.Debugf("Log upload succeeded - length: %d", len(logs))
 	}
 
-	s.Token = resp.NextSequenceToken
+	if !s.Tokenless {
+		s.Token = resp.NextSequenceToken
+	}
 
 	return nil
 }
@@ -131,3 +161,8 @@ func (s *LogStream) retryBatchWithNewToken(logs []*cloudwatchlogs.InputLogEvent)
 
 	return s.Log(logs)
 }
+
+func isRequestError(err error) bool {
+	awserr, ok := err.(awserr.Error)
+	return ok && awserr.Code() == request.ErrCodeRequestError
+}
@@ -1,7 +1,9 @@
 package cloudwatch
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -33,7 +35,8 @@ func (s *LogStreamSuite) SetUpTest(c *C) {
 		WithCredentials(creds).
 		WithEndpoint(s.mock.URL).
 		WithRegion(REGION).
-		WithDisableSSL(true)
+		WithDisableSSL(true).
+		WithSleepDelay(func(time.Duration) {})
 	session := session.New(config)
 
 	s.stream = &LogStream{
@@ -47,7 +50,13 @@ func (s *LogStreamSuite) TearDownTest(c *C) {
 	s.mock.Close()
 }
 
+func now() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
 func (s *LogStreamSuite) TestNewStream(c *C) {
+	s.mock.AddGroup("group")
+
 	err := s.stream.Init()
 	streams := s.mock.GetStreams("group")
 
@@ -94,7 +103,7 @@ func (s *LogStreamSuite) TestPutLogsToNewStream(c *C) {
 	logs := []*cloudwatchlogs.InputLogEvent{
 		&cloudwatchlogs.InputLogEvent{
 			Message:   aws.String("body"),
-			Timestamp: aws.Int64(0),
+			Timestamp: aws.Int64(now()),
 		},
 	}
 
@@ -113,7 +122,7 @@ func (s *LogStreamSuite) TestPutLogsToExistingStream(c *C) {
 	logs := []*cloudwatchlogs.InputLogEvent{
 		&cloudwatchlogs.InputLogEvent{
 			Message:   aws.String("body"),
-			Timestamp: aws.Int64(0),
+			Timestamp: aws.Int64(now()),
 		},
 	}
 	s.stream.Log(logs)
@@ -137,7 +146,7 @@ func (s *LogStreamSuite) TestHandlesBadSequenceToken(c *C) {
 	logs := []*cloudwatchlogs.InputLogEvent{
 		&cloudwatchlogs.InputLogEvent{
 			Message:   aws.String("body"),
-			Timestamp: aws.Int64(0),
+			Timestamp: aws.Int64(now()),
 		},
 	}
 	err := s.stream.Log(logs)
@@ -147,3 +156,195 @@ func (s *LogStreamSuite) TestHandlesBadSequenceToken(c *C) {
 	c.Assert(token, Equals, "11")
 	c.Assert(stream.LogCount, Equals, 1)
 }
+
+func (s *LogStreamSuite) TestTokenlessStreamIgnoresToken(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.stream.Tokenless = true
+
+	err := s.stream.Init()
+
+	c.Assert(err, IsNil)
+	c.Assert(s.stream.Token, IsNil)
+}
+
+func (s *LogStreamSuite) TestTokenlessPutOmitsToken(c *C) {
+	s.mock.Tokenless = true
+	s.mock.AddStream("group", "stream")
+	s.stream.Tokenless = true
+	s.stream.Token = aws.String("stale")
+
+	logs := []*cloudwatchlogs.InputLogEvent{
+		&cloudwatchlogs.InputLogEvent{
+			Message:   aws.String("body"),
+			Timestamp: aws.Int64(now()),
+		},
+	}
+
+	c.Assert(s.stream.Log(logs), IsNil)
+	c.Assert(s.stream.Log(logs), IsNil)
+
+	stream := s.mock.GetStream("group", "stream")
+	c.Assert(stream.LogCount, Equals, 2)
+	c.Assert(stream.Token, Equals, 0)
+}
+
+func (s *LogStreamSuite) TestTokenlessDoesNotRetryTokenErrors(c *C) {
+	s.mock.AddStream("group", "stream")
+	stream := s.mock.GetStream("group", "stream")
+	stream.Token = 10
+	s.stream.Tokenless = true
+
+	logs := []*cloudwatchlogs.InputLogEvent{
+		&cloudwatchlogs.InputLogEvent{
+			Message:   aws.String("body"),
+			Timestamp: aws.Int64(now()),
+		},
+	}
+	err := s.stream.Log(logs)
+
+	c.Assert(err, NotNil)
+	c.Assert(stream.LogCount, Equals, 0)
+}
+
+func (s *LogStreamSuite) TestFailsWithoutGroup(c *C) {
+	err := s.stream.Init()
+
+	c.Assert(err, ErrorMatches, "ResourceNotFoundException: .*")
+}
+
+func (s *LogStreamSuite) TestRejectsBatchesOutOfOrder(c *C) {
+	s.mock.AddStream("group", "stream")
+
+	logs := []*cloudwatchlogs.InputLogEvent{
+		{Message: aws.String("second"), Timestamp: aws.Int64(now())},
+		{Message: aws.String("first"), Timestamp: aws.Int64(now() - 1000)},
+	}
+	err := s.stream.Log(logs)
+
+	c.Assert(err, ErrorMatches, "InvalidParameterException: .*chronological order.*")
+	c.Assert(s.mock.GetStream("group", "stream").LogCount, Equals, 0)
+}
+
+func (s *LogStreamSuite) TestRejectsBatchesOverTheSizeLimit(c *C) {
+	s.mock.AddStream("group", "stream")
+
+	message := aws.String(strings.Repeat("x", test.MaxEventSize-test.EventOverhead))
+	logs := []*cloudwatchlogs.InputLogEvent{}
+	for i := 0; i < 4; i++ {
+		logs = append(logs, &cloudwatchlogs.InputLogEvent{Message: message, Timestamp: aws.Int64(now())})
+	}
+
+	c.Assert(s.stream.Log(logs), IsNil)
+
+	logs = append(logs, logs[0])
+	err := s.stream.Log(logs)
+
+	c.Assert(err, ErrorMatches, "InvalidParameterException: .*")
+	c.Assert(s.mock.GetStream("group", "stream").LogCount, Equals, 4)
+}
+
+func (s *LogStreamSuite) TestSucceedsWithRejectedEvents(c *C) {
+	s.mock.AddStream("group", "stream")
+
+	old := now() - int64(14*24*time.Hour/time.Millisecond) - 1000
+	logs := []*cloudwatchlogs.InputLogEvent{
+		{Message: aws.String("old"), Timestamp: aws.Int64(old)},
+		{Message: aws.String("new"), Timestamp: aws.Int64(old + int64(23*time.Hour/time.Millisecond))},
+	}
+	err := s.stream.Log(logs)
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetEvents("group", "stream"), DeepEquals, []string{"new"})
+}
+
+func (s *LogStreamSuite) TestRetriesThrottledUploads(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Action: "PutLogEvents", Times: 2, Error: "ThrottlingException"})
+
+	err := s.stream.Log(s.events("body"))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetEvents("group", "stream"), DeepEquals, []string{"body"})
+}
+
+func (s *LogStreamSuite) TestFailsWhenThrottlingPersists(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Action: "PutLogEvents", Error: "ThrottlingException"})
+
+	err := s.stream.Log(s.events("body"))
+
+	c.Assert(err, ErrorMatches, "ThrottlingException: .*")
+	c.Assert(s.mock.GetStream("group", "stream").LogCount, Equals, 0)
+}
+
+func (s *LogStreamSuite) TestRetriesServerErrors(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Action: "PutLogEvents", Times: 1, Status: 500})
+
+	err := s.stream.Log(s.events("body"))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetStream("group", "stream").LogCount, Equals, 1)
+}
+
+func (s *LogStreamSuite) TestRetriesResetConnections(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Action: "PutLogEvents", Times: 1, Reset: true})
+
+	err := s.stream.Log(s.events("body"))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetStream("group", "stream").LogCount, Equals, 1)
+}
+
+func (s *LogStreamSuite) TestHandlesAlreadyAcceptedBatches(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Action: "PutLogEvents", Times: 1, DropResponse: true})
+
+	c.Assert(s.stream.Log(s.events("first")), IsNil)
+	c.Assert(s.stream.Log(s.events("second")), IsNil)
+
+	c.Assert(s.mock.GetEvents("group", "stream"), DeepEquals, []string{"first", "second"})
+}
+
+func (s *LogStreamSuite) TestToleratesLatency(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Action: "PutLogEvents", Latency: 20 * time.Millisecond})
+
+	start := time.Now()
+	err := s.stream.Log(s.events("body"))
+
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start) >= 20*time.Millisecond, Equals, true)
+}
+
+func (s *LogStreamSuite) TestSucceedsWithInjectedTooOldEvents(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Action: "PutLogEvents", Times: 1, TooOld: 1})
+
+	err := s.stream.Log(s.events("old", "new"))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetEvents("group", "stream"), DeepEquals, []string{"new"})
+}
+
+func (s *LogStreamSuite) TestAppliesFaultsPerStream(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.mock.AddFault(&test.Fault{Stream: "other", Error: "ThrottlingException"})
+
+	err := s.stream.Log(s.events("body"))
+
+	c.Assert(err, IsNil)
+}
+
+func (s *LogStreamSuite) events(messages ...string) []*cloudwatchlogs.InputLogEvent {
+	events := []*cloudwatchlogs.InputLogEvent{}
+	for _, message := range messages {
+		events = append(events, &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(message),
+			Timestamp: aws.Int64(now()),
+		})
+	}
+
+	return events
+}
@@ -0,0 +1,218 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	metrics "github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// metricDataLength is the maximum number of metrics in a PutMetricData call.
+const metricDataLength = 1000
+
+func measure(in <-chan Log, m *Metrics) <-chan Log {
+	return pipe(in, measureStep(m))
+}
+
+func measureStep(m *Metrics) step {
+	if m == nil {
+		return nil
+	}
+
+	return func(l Log) Log {
+		if msg, ok := l.(*LogMessage); ok {
+			m.Observe(msg)
+		}
+
+		return l
+	}
+}
+
+// MetricRule derives a metric from log lines. Count rules count lines that
+// match a pattern, and sum rules add up a numeric field of JSON lines.
+type MetricRule struct {
+	Name    string
+	Kind    string
+	Pattern *regexp.Regexp
+	Field   string
+}
+
+// ParseMetricRules parses semicolon-separated rules in the form
+// name:count:pattern or name:sum:field.
+func ParseMetricRules(value string) ([]*MetricRule, error) {
+	var rules []*MetricRule
+
+	for _, r := range strings.Split(value, ";") {
+		if r == "" {
+			continue
+		}
+
+		parts := strings.SplitN(r, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid metric rule: %s", r)
+		}
+
+		rule := &MetricRule{Name: parts[0], Kind: parts[1]}
+
+		switch rule.Kind {
+		case "count":
+			re, err := regexp.Compile(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric rule pattern: %v", err)
+			}
+			rule.Pattern = re
+		case "sum":
+			rule.Field = parts[2]
+		default:
+			return nil, fmt.Errorf("invalid metric rule type: %s", rule.Kind)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Metrics aggregates metric rules per container and periodically publishes
+// them to CloudWatch. With a Budget, the bytes it holds are published as
+// BufferedBytes, with a host dimension.
+type Metrics struct {
+	Namespace string
+	Rules     []*MetricRule
+	Budget    *Budget
+	Hostname  string
+
+	mutex   sync.Mutex
+	values  map[metricKey]float64
+	service *metrics.CloudWatch
+}
+
+type metricKey struct {
+	name      string
+	container string
+}
+
+// NewMetrics creates Metrics that publish to the given namespace.
+func NewMetrics(session *session.Session, namespace string, rules []*MetricRule) *Metrics {
+	return &Metrics{
+		Namespace: namespace,
+		Rules:     rules,
+		values:    map[metricKey]float64{},
+		service:   metrics.New(session),
+	}
+}
+
+// Observe applies every rule to a log.
+func (m *Metrics) Observe(msg *LogMessage) {
+	var object map[string]interface{}
+	container := ""
+	if msg.Container != nil {
+		container = strings.TrimPrefix(msg.Container.Name, "/")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, rule := range m.Rules {
+		key := metricKey{name: rule.Name, container: container}
+
+		switch rule.Kind {
+		case "count":
+			if rule.Pattern.MatchString(msg.Data) {
+				m.values[key]++
+			}
+		case "sum":
+			if object == nil {
+				object = map[string]interface{}{}
+				json.Unmarshal([]byte(msg.Data), &object)
+			}
+
+			if value, ok := object[rule.Field].(float64); ok {
+				m.values[key] += value
+			}
+		}
+	}
+}
+
+// Flush returns the metrics aggregated since the last flush.
+func (m *Metrics) Flush(now time.Time) []*metrics.MetricDatum {
+	m.mutex.Lock()
+	values := m.values
+	m.values = map[metricKey]float64{}
+	m.mutex.Unlock()
+
+	data := make([]*metrics.MetricDatum, 0, len(values))
+
+	for key, value := range values {
+		datum := &metrics.MetricDatum{
+			MetricName: aws.String(key.name),
+			Timestamp:  aws.Time(now),
+			Value:      aws.Float64(value),
+		}
+
+		if key.container != "" {
+			datum.Dimensions = []*metrics.Dimension{
+				{Name: aws.String("container"), Value: aws.String(key.container)},
+			}
+		}
+
+		data = append(data, datum)
+	}
+
+	if m.Budget != nil {
+		data = append(data, &metrics.MetricDatum{
+			MetricName: aws.String("BufferedBytes"),
+			Timestamp:  aws.Time(now),
+			Unit:       aws.String("Bytes"),
+			Value:      aws.Float64(float64(m.Budget.Used())),
+			Dimensions: []*metrics.Dimension{
+				{Name: aws.String("host"), Value: aws.String(m.Hostname)},
+			},
+		})
+	}
+
+	return data
+}
+
+// Start publishes aggregated metrics on every interval until done is closed.
+func (m *Metrics) Start(interval time.Duration, clock Clock, done <-chan struct{}) {
+	for {
+		select {
+		case <-clock.After(interval):
+			m.publish(m.Flush(clock.Now()))
+		case <-done:
+			m.publish(m.Flush(clock.Now()))
+			return
+		}
+	}
+}
+
+func (m *Metrics) publish(data []*metrics.MetricDatum) {
+	for len(data) > 0 {
+		n := len(data)
+		if n > metricDataLength {
+			n = metricDataLength
+		}
+
+		params := &metrics.PutMetricDataInput{
+			Namespace:  aws.String(m.Namespace),
+			MetricData: data[:n],
+		}
+
+		if _, err := m.service.PutMetricData(params); err != nil {
+			log.Errorf("Metric upload failed - length: %d, error: %v", n, err)
+		} else {
+			log.Debugf("Metric upload succeeded - length: %d", n)
+		}
+
+		data = data[n:]
+	}
+}
@@ -0,0 +1,108 @@
+package cloudwatch
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type MetricsSuite struct {
+	metrics *Metrics
+}
+
+var _ = Suite(&MetricsSuite{})
+
+func (s *MetricsSuite) SetUpTest(c *C) {
+	rules, err := ParseMetricRules("errors:count:ERROR;duration:sum:duration_ms")
+	c.Assert(err, IsNil)
+
+	s.metrics = &Metrics{Namespace: "app", Rules: rules, values: map[metricKey]float64{}}
+}
+
+func (s *MetricsSuite) observe(name, data string) {
+	container := &docker.Container{Name: "/" + name}
+	s.metrics.Observe(&LogMessage{Message: &router.Message{Container: container, Data: data}})
+}
+
+func (s *MetricsSuite) values() map[string]float64 {
+	values := map[string]float64{}
+	for _, datum := range s.metrics.Flush(time.Now()) {
+		name := aws.StringValue(datum.MetricName)
+		if len(datum.Dimensions) != 0 {
+			name += "/" + aws.StringValue(datum.Dimensions[0].Value)
+		}
+		values[name] = aws.Float64Value(datum.Value)
+	}
+	return values
+}
+
+func (s *MetricsSuite) TestParsesRules(c *C) {
+	rules, err := ParseMetricRules("requests:count:.;latency:sum:latency")
+
+	c.Assert(err, IsNil)
+	c.Assert(rules, HasLen, 2)
+	c.Assert(rules[0].Kind, Equals, "count")
+	c.Assert(rules[1].Field, Equals, "latency")
+}
+
+func (s *MetricsSuite) TestRejectsInvalidRules(c *C) {
+	_, err := ParseMetricRules("errors:max:ERROR")
+	c.Assert(err, NotNil)
+
+	_, err = ParseMetricRules("errors:count")
+	c.Assert(err, NotNil)
+
+	_, err = ParseMetricRules("errors:count:(")
+	c.Assert(err, NotNil)
+}
+
+func (s *MetricsSuite) TestCountsMatchingLinesPerContainer(c *C) {
+	s.observe("web", "ERROR failed")
+	s.observe("web", "INFO ok")
+	s.observe("web", "ERROR failed again")
+	s.observe("db", "ERROR failed")
+
+	values := s.values()
+
+	c.Assert(values["errors/web"], Equals, float64(2))
+	c.Assert(values["errors/db"], Equals, float64(1))
+}
+
+func (s *MetricsSuite) TestSumsJSONFields(c *C) {
+	s.observe("web", `{"duration_ms":12.5}`)
+	s.observe("web", `{"duration_ms":7.5}`)
+	s.observe("web", `{"duration_ms":"slow"}`)
+	s.observe("web", "duration_ms=100")
+
+	c.Assert(s.values()["duration/web"], Equals, float64(20))
+}
+
+func (s *MetricsSuite) TestFlushResetsValues(c *C) {
+	s.observe("web", "ERROR failed")
+	s.metrics.Flush(time.Now())
+
+	c.Assert(s.metrics.Flush(time.Now()), HasLen, 0)
+}
+
+func (s *MetricsSuite) TestReportsBufferedBytes(c *C) {
+	s.metrics.Budget = NewBudget()
+	s.metrics.Hostname = "host1"
+	s.metrics.Budget.Acquire(42)
+
+	c.Assert(s.values(), DeepEquals, map[string]float64{"BufferedBytes/host1": 42})
+	c.Assert(s.values(), DeepEquals, map[string]float64{"BufferedBytes/host1": 42})
+}
+
+func (s *MetricsSuite) TestMeasurePassesLogsThrough(c *C) {
+	input := make(chan Log, 1)
+	output := measure(input, s.metrics)
+
+	input <- &LogMessage{Message: &router.Message{Data: "ERROR failed"}}
+	log := <-output
+
+	c.Assert(log.Body(), Equals, "ERROR failed")
+	c.Assert(s.values()["errors"], Equals, float64(1))
+}
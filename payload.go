@@ -0,0 +1,111 @@
+package cloudwatch
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// payloads recycles the events of finished uploads.
+var payloads = sync.Pool{
+	New: func() interface{} { return &payload{} },
+}
+
+// payload holds the events of an upload. Events point into the payload's own
+// arrays, so building a payload does not allocate once its arrays have grown
+// to the size of a batch.
+type payload struct {
+	events     []*cloudwatchlogs.InputLogEvent
+	values     []cloudwatchlogs.InputLogEvent
+	messages   []string
+	timestamps []int64
+	size       int
+}
+
+// newPayload returns an empty payload, which the Batcher fills as logs are
+// added to a batch. The payload must be released once the upload is
+// finished, and its events must not be used afterwards.
+func newPayload() *payload {
+	return payloads.Get().(*payload)
+}
+
+// append adds the event of a log to the payload.
+func (p *payload) append(l Log) {
+	if len(p.values) == cap(p.values) {
+		p.grow()
+	}
+
+	i := len(p.values)
+	p.messages = append(p.messages, l.Body())
+	p.timestamps = append(p.timestamps, l.Timestamp())
+	p.values = append(p.values, cloudwatchlogs.InputLogEvent{
+		Message:   &p.messages[i],
+		Timestamp: &p.timestamps[i],
+	})
+	p.events = append(p.events, &p.values[i])
+	p.size += len(p.messages[i])
+}
+
+// grow doubles the payload's arrays. Existing events are pointed at the new
+// arrays, so growing costs as much as appending to a slice.
+func (p *payload) grow() {
+	length, capacity := len(p.values), 2*cap(p.values)
+	if capacity == 0 {
+		capacity = 64
+	}
+
+	events := make([]*cloudwatchlogs.InputLogEvent, length, capacity)
+	values := make([]cloudwatchlogs.InputLogEvent, length, capacity)
+	messages := make([]string, length, capacity)
+	timestamps := make([]int64, length, capacity)
+
+	copy(messages, p.messages)
+	copy(timestamps, p.timestamps)
+
+	for i := range values {
+		values[i] = cloudwatchlogs.InputLogEvent{
+			Message:   &messages[i],
+			Timestamp: &timestamps[i],
+		}
+		events[i] = &values[i]
+	}
+
+	p.events, p.values, p.messages, p.timestamps = events, values, messages, timestamps
+}
+
+// chronological reports whether the events are already in order, so that
+// sorting can be skipped.
+func (p *payload) chronological() bool {
+	for i := 1; i < len(p.events); i++ {
+		if *p.events[i].Timestamp < *p.events[i-1].Timestamp {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sort puts the events in chronological order without moving their values.
+func (p *payload) sort() {
+	sort.SliceStable(p.events, func(i, j int) bool {
+		return *p.events[i].Timestamp < *p.events[j].Timestamp
+	})
+}
+
+// release returns the payload for reuse, dropping its references to messages.
+func (p *payload) release() {
+	for i := range p.values {
+		p.events[i] = nil
+		p.values[i] = cloudwatchlogs.InputLogEvent{}
+		p.messages[i] = ""
+	}
+
+	p.events = p.events[:0]
+	p.values = p.values[:0]
+	p.messages = p.messages[:0]
+	p.timestamps = p.timestamps[:0]
+	p.size = 0
+
+	payloads.Put(p)
+}
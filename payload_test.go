@@ -0,0 +1,81 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type PayloadSuite struct{}
+
+var _ = Suite(&PayloadSuite{})
+
+// build fills a payload with logs, as the Batcher does.
+func (s *PayloadSuite) build(logs ...Log) *payload {
+	p := newPayload()
+	for _, l := range logs {
+		p.append(l)
+	}
+
+	return p
+}
+
+func (s *PayloadSuite) TestBuildsEvents(c *C) {
+	p := s.build(
+		&LogMessage{Message: &router.Message{Data: "first", Time: time.Unix(1, 0)}},
+		&LogMessage{Message: &router.Message{Data: "second", Time: time.Unix(2, 0)}},
+	)
+	defer p.release()
+
+	c.Assert(p.events, HasLen, 2)
+	c.Assert(p.size, Equals, 11)
+	c.Assert(aws.StringValue(p.events[1].Message), Equals, "second")
+	c.Assert(aws.Int64Value(p.events[1].Timestamp), Equals, int64(2000))
+}
+
+func (s *PayloadSuite) TestReusesReleasedPayloads(c *C) {
+	p := s.build(&LogMessage{Message: &router.Message{Data: "first"}}, &LogMessage{Message: &router.Message{Data: "second"}})
+	p.release()
+
+	p = s.build(&LogMessage{Message: &router.Message{Data: "third"}})
+	defer p.release()
+
+	c.Assert(p.events, HasLen, 1)
+	c.Assert(p.size, Equals, 5)
+	c.Assert(aws.StringValue(p.events[0].Message), Equals, "third")
+}
+
+func (s *PayloadSuite) TestKeepsEventsWhenGrowing(c *C) {
+	var logs []Log
+	for i := 0; i < 100; i++ {
+		logs = append(logs, &LogMessage{Message: &router.Message{Data: fmt.Sprint(i), Time: time.Unix(int64(i), 0)}})
+	}
+
+	p := s.build(logs...)
+	defer p.release()
+
+	for i, event := range p.events {
+		c.Assert(aws.StringValue(event.Message), Equals, fmt.Sprint(i))
+		c.Assert(aws.Int64Value(event.Timestamp), Equals, int64(i*1000))
+	}
+}
+
+func (s *PayloadSuite) TestSortsOnlyEvents(c *C) {
+	first := &LogMessage{Message: &router.Message{Data: "first", Time: time.Unix(1, 0)}}
+	second := &LogMessage{Message: &router.Message{Data: "second", Time: time.Unix(2, 0)}}
+
+	p := s.build(first, second)
+	c.Assert(p.chronological(), Equals, true)
+	p.release()
+
+	p = s.build(second, first)
+	defer p.release()
+	c.Assert(p.chronological(), Equals, false)
+
+	p.sort()
+	c.Assert(aws.StringValue(p.events[0].Message), Equals, "first")
+	c.Assert(aws.StringValue(p.values[0].Message), Equals, "second")
+}
@@ -0,0 +1,50 @@
+package cloudwatch
+
+// step processes a single log, returning nil to drop it.
+type step func(Log) Log
+
+// pipe runs steps over each log in a single goroutine, so chaining steps
+// costs no extra channel hop. Nil steps are skipped, and the input is
+// returned as is when there are no steps to run.
+func pipe(in <-chan Log, steps ...step) <-chan Log {
+	steps = compact(steps)
+	if len(steps) == 0 {
+		return in
+	}
+
+	out := make(chan Log)
+
+	go func() {
+		defer close(out)
+
+		for l := range in {
+			if l = run(l, steps); l != nil {
+				out <- l
+			}
+		}
+	}()
+
+	return out
+}
+
+// run passes a log through steps until one drops it.
+func run(l Log, steps []step) Log {
+	for _, s := range steps {
+		if l = s(l); l == nil {
+			return nil
+		}
+	}
+
+	return l
+}
+
+func compact(steps []step) []step {
+	compacted := make([]step, 0, len(steps))
+	for _, s := range steps {
+		if s != nil {
+			compacted = append(compacted, s)
+		}
+	}
+
+	return compacted
+}
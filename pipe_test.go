@@ -0,0 +1,60 @@
+package cloudwatch
+
+import (
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type PipeSuite struct{}
+
+var _ = Suite(&PipeSuite{})
+
+func (s *PipeSuite) TestRunsStepsInOrder(c *C) {
+	input := make(chan Log, 1)
+	output := pipe(input, sanitizeStep(true), filterStep, structureStep(true))
+
+	input <- &LogMessage{Message: &router.Message{Data: "\x1b[31m\x1b[0m", Source: "stdout"}}
+	input <- &LogMessage{Message: &router.Message{Data: "\x1b[31mred\x1b[0m", Source: "stdout"}}
+	close(input)
+
+	log := <-output
+	_, open := <-output
+
+	c.Assert(open, Equals, false)
+	c.Assert(log.Body(), Equals, `{"message":"red","source":"stdout"}`)
+}
+
+func (s *PipeSuite) TestStopsAtDroppedLogs(c *C) {
+	input := make(chan Log, 1)
+	called := false
+	output := pipe(input, filterStep, func(l Log) Log {
+		called = true
+		return l
+	})
+
+	input <- &LogMessage{Message: &router.Message{Data: " "}}
+	close(input)
+	_, open := <-output
+
+	c.Assert(open, Equals, false)
+	c.Assert(called, Equals, false)
+}
+
+func (s *PipeSuite) TestReturnsInputWithoutSteps(c *C) {
+	input := make(chan Log)
+	output := pipe(input, nil, sanitizeStep(false))
+
+	c.Assert(output, Equals, (<-chan Log)(input))
+}
+
+func (s *PipeSuite) TestTransformRunsSteps(c *C) {
+	input := make(chan *router.Message, 1)
+	output := transform(input, sourcesStep([]string{"stderr"}))
+
+	input <- &router.Message{Data: "out", Source: "stdout"}
+	input <- &router.Message{Data: "err", Source: "stderr"}
+	close(input)
+	log := <-output
+
+	c.Assert(log.Body(), Equals, "err")
+}
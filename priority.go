@@ -0,0 +1,303 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Logs are sorted into lanes by priority. High-priority batches are uploaded
+// first, and low-priority batches are the first to be dropped.
+const (
+	priorityHigh = iota
+	priorityNormal
+	priorityLow
+)
+
+var priorities = map[string]int{
+	"high":   priorityHigh,
+	"normal": priorityNormal,
+	"low":    priorityLow,
+}
+
+// laneShares are the fractions of the memory limit that each lane may fill,
+// so that lower lanes are dropped before higher lanes run out of memory.
+var laneShares = []float64{1, 0.75, 0.5}
+
+// laneQueueLength is the number of batches for a destination that may wait
+// for upload before lower-priority batches are dropped.
+const laneQueueLength = 4
+
+// levelPattern matches the level of plain text lines, e.g. "ERROR: failed",
+// "[warn] slow" or "2016-05-05T12:00:00Z INFO: started". The level must be in
+// brackets or followed by a colon, so that words such as "error" in a
+// message are not taken for its level.
+var levelPattern = regexp.MustCompile(`(?i)^(?:\S+\s+){0,2}?(?:\[(trace|debug|info|warn|warning|error|fatal|panic|critical)\]|(trace|debug|info|warn|warning|error|fatal|panic|critical):)(?:\s|$)`)
+
+// logfmtLevelPattern matches the level of logfmt lines, e.g. "level=error".
+var logfmtLevelPattern = regexp.MustCompile(`(?i)\blevel=["]?(\w+)`)
+
+// PriorityRule assigns logs to a lane by their level, by a pattern, or by a
+// label of their container.
+type PriorityRule struct {
+	Priority int
+	Kind     string
+	Levels   []string
+	Pattern  *regexp.Regexp
+	Label    string
+	Value    string
+}
+
+// ParsePriorityRules parses semicolon-separated rules in the form
+// priority:level:levels, priority:pattern:pattern or priority:label:key=value,
+// where priority is high, normal or low and levels are comma-separated.
+func ParsePriorityRules(value string) ([]*PriorityRule, error) {
+	var rules []*PriorityRule
+
+	for _, r := range strings.Split(value, ";") {
+		if r == "" {
+			continue
+		}
+
+		parts := strings.SplitN(r, ":", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			return nil, fmt.Errorf("invalid priority rule: %s", r)
+		}
+
+		priority, ok := priorities[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("invalid priority: %s", parts[0])
+		}
+
+		rule := &PriorityRule{Priority: priority, Kind: parts[1]}
+
+		switch rule.Kind {
+		case "level":
+			rule.Levels = strings.Split(strings.ToLower(parts[2]), ",")
+		case "pattern":
+			re, err := regexp.Compile(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid priority rule pattern: %v", err)
+			}
+			rule.Pattern = re
+		case "label":
+			label := strings.SplitN(parts[2], "=", 2)
+			rule.Label = label[0]
+			if len(label) == 2 {
+				rule.Value = label[1]
+			}
+		default:
+			return nil, fmt.Errorf("invalid priority rule type: %s", rule.Kind)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Prioritizer sorts logs into lanes with the first rule that matches. Logs
+// that match no rule have normal priority. Level rules only read the level
+// field of JSON lines when JSON is set, so raw lines are not decoded.
+type Prioritizer struct {
+	Rules []*PriorityRule
+	JSON  bool
+}
+
+// NewPrioritizer creates a Prioritizer from rules, or returns nil when there
+// are no rules, in which case every log shares a single lane.
+func NewPrioritizer(rules []*PriorityRule, json bool) *Prioritizer {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return &Prioritizer{Rules: rules, JSON: json}
+}
+
+// Lanes returns the number of lanes logs are sorted into.
+func (p *Prioritizer) Lanes() int {
+	if p == nil {
+		return 1
+	}
+
+	return len(laneShares)
+}
+
+// Priority returns the lane of a log.
+func (p *Prioritizer) Priority(l Log) int {
+	if p == nil {
+		return 0
+	}
+
+	msg, ok := l.(*LogMessage)
+	if !ok {
+		return priorityNormal
+	}
+
+	level := ""
+	for _, rule := range p.Rules {
+		switch rule.Kind {
+		case "level":
+			if level == "" {
+				level = logLevel(msg.Data, p.JSON)
+			}
+
+			if contains(rule.Levels, level) {
+				return rule.Priority
+			}
+		case "pattern":
+			if rule.Pattern.MatchString(msg.Data) {
+				return rule.Priority
+			}
+		case "label":
+			if value, ok := msg.Labels()[rule.Label]; ok && (rule.Value == "" || value == rule.Value) {
+				return rule.Priority
+			}
+		}
+	}
+
+	return priorityNormal
+}
+
+// logLevel returns the lower case level of a line from the level or severity
+// field of a JSON object when json is set, from a logfmt level, or from a
+// level near the start of plain text.
+func logLevel(data string, json bool) string {
+	if json && strings.HasPrefix(strings.TrimSpace(data), "{") {
+		if object := decodeObject(data); object != nil {
+			for _, field := range []string{"level", "severity"} {
+				if level, ok := object[field].(string); ok {
+					return strings.ToLower(level)
+				}
+			}
+			return ""
+		}
+	}
+
+	if match := logfmtLevelPattern.FindStringSubmatch(data); match != nil {
+		return strings.ToLower(match[1])
+	}
+
+	if match := levelPattern.FindStringSubmatch(data); match != nil {
+		return strings.ToLower(match[1] + match[2])
+	}
+
+	return ""
+}
+
+// schedule merges the batches of a destination's lanes and hands them to the
+// uploader in priority order. When more than laneQueueLength batches wait,
+// the oldest batch of the lowest lane is dropped. Batches of the top lane are
+// never dropped; the lanes block instead, as a single lane does. A send to a
+// lane returns once its batch is queued.
+func (a *Adapter) schedule(dest Destination, lanes []<-chan Batch) <-chan Batch {
+	if len(lanes) == 1 {
+		return lanes[0]
+	}
+
+	out := make(chan Batch)
+
+	go func() {
+		defer close(out)
+
+		open := append([]<-chan Batch(nil), lanes...)
+		blocked := make([]<-chan Batch, len(lanes))
+		queues := make([][]Batch, len(lanes))
+		pending := 0
+
+		receive := func(lane int, batch Batch, ok bool) {
+			if !ok {
+				open[lane] = nil
+				return
+			}
+
+			queues[lane] = append(queues[lane], batch)
+			pending++
+
+			if pending > laneQueueLength {
+				a.shed(dest, queues)
+				pending--
+			}
+		}
+
+		for pending > 0 || !closed(open) {
+			var send chan<- Batch
+			var next Batch
+			lane := 0
+
+			for i, queue := range queues {
+				if len(queue) != 0 {
+					send, next, lane = out, queue[0], i
+					break
+				}
+			}
+
+			in := open
+			if pending >= laneQueueLength && !sheddable(queues) {
+				in = blocked
+			}
+
+			select {
+			case batch, ok := <-in[priorityHigh]:
+				receive(priorityHigh, batch, ok)
+			case batch, ok := <-in[priorityNormal]:
+				receive(priorityNormal, batch, ok)
+			case batch, ok := <-in[priorityLow]:
+				receive(priorityLow, batch, ok)
+			case send <- next:
+				queues[lane] = queues[lane][1:]
+				pending--
+			}
+		}
+	}()
+
+	return out
+}
+
+// closed reports whether every lane is closed.
+func closed(lanes []<-chan Batch) bool {
+	for _, lane := range lanes {
+		if lane != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sheddable reports whether a batch below the top lane is waiting.
+func sheddable(queues [][]Batch) bool {
+	for _, queue := range queues[1:] {
+		if len(queue) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shed drops the oldest batch of the lowest lane that has one.
+func (a *Adapter) shed(dest Destination, queues [][]Batch) {
+	for i := len(queues) - 1; i > 0; i-- {
+		if len(queues[i]) == 0 {
+			continue
+		}
+
+		batch := queues[i][0]
+		queues[i] = queues[i][1:]
+
+		size := 0
+		for _, l := range batch.Logs {
+			size += l.Size()
+		}
+
+		log.Warnf("Dropping batch behind higher-priority uploads - group: %s, stream: %s, length: %d, priority: %d", dest.Group, dest.Stream, len(batch.Logs), i)
+		a.stats.Dropped(len(batch.Logs))
+		a.budget.Release(size)
+		releaseBatch(batch)
+
+		return
+	}
+}
@@ -0,0 +1,163 @@
+package cloudwatch
+
+import (
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type PrioritySuite struct {
+	adapter *Adapter
+}
+
+var _ = Suite(&PrioritySuite{})
+
+func (s *PrioritySuite) SetUpTest(c *C) {
+	s.adapter = &Adapter{stats: &Stats{}, budget: NewBudget()}
+}
+
+func (s *PrioritySuite) TestParsesRules(c *C) {
+	rules, err := ParsePriorityRules("high:level:ERROR,fatal;low:pattern:^GET /health;high:label:team=payments;low:label:debug")
+
+	c.Assert(err, IsNil)
+	c.Assert(rules, HasLen, 4)
+	c.Assert(rules[0].Priority, Equals, priorityHigh)
+	c.Assert(rules[0].Levels, DeepEquals, []string{"error", "fatal"})
+	c.Assert(rules[1].Pattern.String(), Equals, "^GET /health")
+	c.Assert(rules[2].Label, Equals, "team")
+	c.Assert(rules[2].Value, Equals, "payments")
+	c.Assert(rules[3].Value, Equals, "")
+}
+
+func (s *PrioritySuite) TestRejectsInvalidRules(c *C) {
+	_, err := ParsePriorityRules("urgent:level:error")
+	c.Assert(err, ErrorMatches, "invalid priority: urgent")
+
+	_, err = ParsePriorityRules("high:size:100")
+	c.Assert(err, ErrorMatches, "invalid priority rule type: size")
+
+	_, err = ParsePriorityRules("high:level")
+	c.Assert(err, ErrorMatches, "invalid priority rule: high:level")
+
+	_, err = ParsePriorityRules("high:pattern:(")
+	c.Assert(err, ErrorMatches, "invalid priority rule pattern: .*")
+}
+
+func (s *PrioritySuite) TestDetectsLevels(c *C) {
+	levels := map[string]string{
+		`time=12:00 level=warn msg="slow"`:         "warn",
+		`ERROR: connection refused`:                "error",
+		`[debug] cache miss`:                       "debug",
+		`2016-05-05T12:00:00Z INFO: started`:       "info",
+		`2016/05/05 12:00:00 [FATAL] out of space`: "fatal",
+		`2016-05-05T12:00:00Z INFO started`:        "",
+		`Processed error count: 0`:                 "",
+		`GET /errors 200`:                          "",
+		`{"level":"ERROR","msg":"failed"}`:         "",
+	}
+
+	for line, level := range levels {
+		c.Check(logLevel(line, false), Equals, level, Commentf("line: %s", line))
+	}
+}
+
+func (s *PrioritySuite) TestDetectsJSONLevels(c *C) {
+	levels := map[string]string{
+		`{"level":"ERROR","msg":"failed"}`: "error",
+		`{"severity":"warning"}`:           "warning",
+		`{"msg":"error in message"}`:       "",
+		`ERROR: connection refused`:        "error",
+	}
+
+	for line, level := range levels {
+		c.Check(logLevel(line, true), Equals, level, Commentf("line: %s", line))
+	}
+}
+
+func (s *PrioritySuite) TestAssignsLanes(c *C) {
+	rules, err := ParsePriorityRules("high:level:error;low:pattern:^GET /health;high:label:team=payments")
+	c.Assert(err, IsNil)
+	prioritizer := NewPrioritizer(rules, false)
+
+	c.Assert(prioritizer.Lanes(), Equals, 3)
+	c.Assert(prioritizer.Priority(s.message("ERROR: failed", nil)), Equals, priorityHigh)
+	c.Assert(prioritizer.Priority(s.message("GET /health 200", nil)), Equals, priorityLow)
+	c.Assert(prioritizer.Priority(s.message("GET /health 200", map[string]string{"team": "payments"})), Equals, priorityLow)
+	c.Assert(prioritizer.Priority(s.message("GET / 200", map[string]string{"team": "payments"})), Equals, priorityHigh)
+	c.Assert(prioritizer.Priority(s.message("GET / 200", nil)), Equals, priorityNormal)
+}
+
+func (s *PrioritySuite) TestUsesOneLaneWithoutRules(c *C) {
+	prioritizer := NewPrioritizer(nil, false)
+
+	c.Assert(prioritizer, IsNil)
+	c.Assert(prioritizer.Lanes(), Equals, 1)
+	c.Assert(prioritizer.Priority(s.message("ERROR: failed", nil)), Equals, 0)
+}
+
+func (s *PrioritySuite) TestUploadsHigherPriorityFirst(c *C) {
+	high, low := make(chan Batch), make(chan Batch)
+	out := s.adapter.schedule(Destination{}, []<-chan Batch{high, make(chan Batch), low})
+
+	// Each send waits until the previous batch of its lane is queued.
+	low <- s.batch("low 1")
+	low <- s.batch("low 2")
+	high <- s.batch("high 1")
+	high <- s.batch("high 2")
+
+	c.Assert(s.body(<-out), Equals, "high 1")
+	c.Assert(s.body(<-out), Equals, "high 2")
+	c.Assert(s.body(<-out), Equals, "low 1")
+}
+
+func (s *PrioritySuite) TestDropsLowerPriorityBatchesFirst(c *C) {
+	high, normal, low := make(chan Batch), make(chan Batch), make(chan Batch)
+	out := s.adapter.schedule(Destination{}, []<-chan Batch{high, normal, low})
+
+	// The queue is full of low and normal batches before anything is read,
+	// so each high batch drops the oldest batch of the lowest lane.
+	low <- s.batch("low 1", "low 1")
+	low <- s.batch("low 2", "low 2")
+	normal <- s.batch("normal 1")
+	normal <- s.batch("normal 2")
+	high <- s.batch("high 1")
+	high <- s.batch("high 2")
+	high <- s.batch("high 3")
+	close(high)
+	close(normal)
+	close(low)
+
+	var bodies []string
+	for batch := range out {
+		bodies = append(bodies, s.body(batch))
+	}
+
+	c.Assert(bodies, DeepEquals, []string{"high 1", "high 2", "high 3", "normal 2"})
+	c.Assert(s.adapter.stats.Reset().DroppedEvents, Equals, int64(5))
+}
+
+func (s *PrioritySuite) TestPassesSingleLaneThrough(c *C) {
+	lane := make(chan Batch)
+
+	c.Assert(s.adapter.schedule(Destination{}, []<-chan Batch{lane}), Equals, (<-chan Batch)(lane))
+}
+
+func (s *PrioritySuite) message(data string, labels map[string]string) *LogMessage {
+	container := &docker.Container{Name: "/web", Config: &docker.Config{Labels: labels}}
+	return &LogMessage{Message: &router.Message{Container: container, Data: data, Time: time.Now()}}
+}
+
+func (s *PrioritySuite) batch(data ...string) Batch {
+	var batch Batch
+	for _, d := range data {
+		batch.Logs = append(batch.Logs, s.message(d, nil))
+	}
+
+	return batch
+}
+
+func (s *PrioritySuite) body(batch Batch) string {
+	return batch.Logs[0].Body()
+}
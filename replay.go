@@ -0,0 +1,141 @@
+package cloudwatch
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// CloudWatch rejects batches that span more than a day and events that are
+// older than its retention limit.
+const (
+	maxBatchSpan = 24 * time.Hour
+	maxEventAge  = 14 * 24 * time.Hour
+)
+
+// Replayer uploads events written by a FileSink to CloudWatch.
+type Replayer struct {
+	capacity   Capacity
+	clock      Clock
+	logstreams map[Destination]*LogStream
+	create     func(dest Destination) (*LogStream, error)
+}
+
+// NewReplayer instantiates a Replayer. The configs are applied to its
+// CloudWatch Logs client.
+func NewReplayer(session *session.Session, tokenless bool, configs ...*aws.Config) *Replayer {
+	return &Replayer{
+		capacity:   Capacity{Size: batchSize, Length: batchLength, Overhead: eventOverhead},
+		clock:      realClock{},
+		logstreams: map[Destination]*LogStream{},
+		create: func(dest Destination) (*LogStream, error) {
+			return NewLogStream(session, dest.Group, dest.Stream, tokenless, configs...)
+		},
+	}
+}
+
+// Replay reads newline-delimited records and uploads them to the group and
+// stream of each record. Records are read in full so that each stream's
+// events are sorted and split into batches CloudWatch accepts. Events that
+// are too old for CloudWatch to accept are skipped.
+func (r *Replayer) Replay(reader io.Reader) error {
+	var order []Destination
+	records := map[Destination][]*SinkRecord{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 2*batchSize)
+
+	for scanner.Scan() {
+		record := &SinkRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return err
+		}
+
+		dest := Destination{Group: record.Group, Stream: record.Stream}
+		if _, ok := records[dest]; !ok {
+			order = append(order, dest)
+		}
+		records[dest] = append(records[dest], record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, dest := range order {
+		if err := r.replay(dest, records[dest]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Replayer) replay(dest Destination, records []*SinkRecord) error {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp < records[j].Timestamp
+	})
+
+	oldest := r.clock.Now().Add(-maxEventAge).UnixNano() / int64(time.Millisecond)
+	span := int64(maxBatchSpan / time.Millisecond)
+
+	var events []*cloudwatchlogs.InputLogEvent
+	size, expired := 0, 0
+
+	for _, record := range records {
+		if record.Timestamp < oldest {
+			expired++
+			continue
+		}
+
+		full := len(events) == r.capacity.Length ||
+			size+len(record.Message)+r.capacity.Overhead > r.capacity.Size ||
+			len(events) != 0 && record.Timestamp-aws.Int64Value(events[0].Timestamp) >= span
+
+		if len(events) != 0 && full {
+			if err := r.upload(dest, events); err != nil {
+				return err
+			}
+			events, size = nil, 0
+		}
+
+		size += len(record.Message) + r.capacity.Overhead
+		events = append(events, &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(record.Message),
+			Timestamp: aws.Int64(record.Timestamp),
+		})
+	}
+
+	if expired != 0 {
+		log.Warnf("Skipping expired events - group: %s, stream: %s, length: %d", dest.Group, dest.Stream, expired)
+	}
+
+	if len(events) != 0 {
+		return r.upload(dest, events)
+	}
+
+	return nil
+}
+
+func (r *Replayer) upload(dest Destination, events []*cloudwatchlogs.InputLogEvent) error {
+	logstream, ok := r.logstreams[dest]
+	if !ok {
+		var err error
+		if logstream, err = r.create(dest); err != nil {
+			return err
+		}
+		r.logstreams[dest] = logstream
+	}
+
+	log.Infof("Replaying events - group: %s, stream: %s, length: %d", dest.Group, dest.Stream, len(events))
+
+	return logstream.Log(events)
+}
@@ -0,0 +1,129 @@
+package cloudwatch
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	. "gopkg.in/check.v1"
+)
+
+type ReplaySuite struct {
+	mock     *test.CloudWatchLogsMock
+	replayer *Replayer
+}
+
+var _ = Suite(&ReplaySuite{})
+
+func (s *ReplaySuite) SetUpTest(c *C) {
+	s.mock = test.NewCloudWatchLogsMock()
+	s.mock.Now = func() time.Time { return time.Unix(3, 0) }
+	s.mock.AddGroup("group")
+
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	config := aws.NewConfig().
+		WithCredentials(creds).
+		WithEndpoint(s.mock.URL).
+		WithRegion(REGION).
+		WithDisableSSL(true)
+	service := cloudwatchlogs.New(session.New(config))
+
+	s.replayer = NewReplayer(nil, false)
+	s.replayer.clock = test.NewFakeClock(time.Unix(3, 0))
+	s.replayer.create = func(dest Destination) (*LogStream, error) {
+		logstream := &LogStream{
+			Group:   aws.String(dest.Group),
+			Stream:  aws.String(dest.Stream),
+			service: service,
+		}
+		return logstream, logstream.Init()
+	}
+}
+
+func (s *ReplaySuite) TearDownTest(c *C) {
+	s.mock.Close()
+}
+
+func (s *ReplaySuite) TestReplaysRecordsToTheirStreams(c *C) {
+	file := strings.Join([]string{
+		`{"group":"group","stream":"a","timestamp":1000,"message":"one","reason":"denied"}`,
+		`{"group":"group","stream":"a","timestamp":2000,"message":"two","reason":"denied"}`,
+		`{"group":"group","stream":"b","timestamp":3000,"message":"three","reason":"denied"}`,
+	}, "\n")
+
+	err := s.replayer.Replay(strings.NewReader(file))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetStream("group", "a").LogCount, Equals, 2)
+	c.Assert(s.mock.GetStream("group", "b").LogCount, Equals, 1)
+}
+
+func (s *ReplaySuite) TestSplitsBatchesAtCapacity(c *C) {
+	s.replayer.capacity = Capacity{Size: batchSize, Length: 1}
+	file := strings.Join([]string{
+		`{"group":"group","stream":"a","timestamp":1000,"message":"one"}`,
+		`{"group":"group","stream":"a","timestamp":2000,"message":"two"}`,
+	}, "\n")
+
+	err := s.replayer.Replay(strings.NewReader(file))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetStream("group", "a").LogCount, Equals, 2)
+	c.Assert(s.mock.GetStream("group", "a").Token, Equals, 2)
+}
+
+func (s *ReplaySuite) TestSortsEventsBeforeUploading(c *C) {
+	file := strings.Join([]string{
+		`{"group":"group","stream":"a","timestamp":2000,"message":"two"}`,
+		`{"group":"group","stream":"b","timestamp":3000,"message":"three"}`,
+		`{"group":"group","stream":"a","timestamp":1000,"message":"one"}`,
+	}, "\n")
+
+	err := s.replayer.Replay(strings.NewReader(file))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetStream("group", "a").LogCount, Equals, 2)
+	c.Assert(s.mock.GetStream("group", "a").Token, Equals, 1)
+	c.Assert(s.mock.GetStream("group", "b").LogCount, Equals, 1)
+}
+
+func (s *ReplaySuite) TestSplitsBatchesSpanningMoreThanADay(c *C) {
+	now := time.Unix(0, 0).Add(26 * time.Hour)
+	s.mock.Now = func() time.Time { return now }
+	s.replayer.clock = test.NewFakeClock(now)
+	file := strings.Join([]string{
+		`{"group":"group","stream":"a","timestamp":1000,"message":"one"}`,
+		`{"group":"group","stream":"a","timestamp":90001000,"message":"two"}`,
+	}, "\n")
+
+	err := s.replayer.Replay(strings.NewReader(file))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetStream("group", "a").LogCount, Equals, 2)
+	c.Assert(s.mock.GetStream("group", "a").Token, Equals, 2)
+}
+
+func (s *ReplaySuite) TestSkipsExpiredEvents(c *C) {
+	now := time.Unix(0, 0).Add(15 * 24 * time.Hour)
+	s.mock.Now = func() time.Time { return now }
+	s.replayer.clock = test.NewFakeClock(now)
+	file := strings.Join([]string{
+		`{"group":"group","stream":"a","timestamp":1000,"message":"old"}`,
+		`{"group":"group","stream":"a","timestamp":1292400000,"message":"new"}`,
+	}, "\n")
+
+	err := s.replayer.Replay(strings.NewReader(file))
+
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.GetStream("group", "a").LogCount, Equals, 1)
+}
+
+func (s *ReplaySuite) TestRejectsInvalidRecords(c *C) {
+	err := s.replayer.Replay(strings.NewReader("not json"))
+
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,44 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retry failed records a few times, backing off between attempts, before
+// giving up on them.
+const (
+	recordAttempts = 5
+	recordBackoff  = 100 * time.Millisecond
+)
+
+// retryRecords calls put with the indexes of records to deliver. put returns
+// the indexes of records that failed, which are retried until every record is
+// delivered or the attempts run out. Backoffs are measured by clock.
+func retryRecords(length int, clock Clock, put func(indexes []int) ([]int, error)) error {
+	indexes := make([]int, length)
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	backoff := recordBackoff
+
+	for attempt := 1; ; attempt++ {
+		failed, err := put(indexes)
+		if err != nil {
+			return err
+		}
+
+		if len(failed) == 0 {
+			return nil
+		}
+
+		if attempt == recordAttempts {
+			return fmt.Errorf("%d records failed after %d attempts", len(failed), attempt)
+		}
+
+		<-clock.After(backoff)
+		backoff *= 2
+		indexes = failed
+	}
+}
@@ -0,0 +1,98 @@
+package cloudwatch
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	. "gopkg.in/check.v1"
+)
+
+type RetrySuite struct {
+	clock *test.FakeClock
+	start time.Time
+}
+
+var _ = Suite(&RetrySuite{})
+
+func (s *RetrySuite) SetUpTest(c *C) {
+	s.start = time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC)
+	s.clock = test.NewFakeClock(s.start)
+}
+
+func (s *RetrySuite) TestRetriesFailedRecords(c *C) {
+	var attempts [][]int
+
+	err := backingOff(s.clock, func() error {
+		return retryRecords(3, s.clock, func(indexes []int) ([]int, error) {
+			attempts = append(attempts, indexes)
+			if len(attempts) == 1 {
+				return []int{indexes[1]}, nil
+			}
+			return nil, nil
+		})
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(attempts, DeepEquals, [][]int{{0, 1, 2}, {1}})
+}
+
+func (s *RetrySuite) TestBacksOffExponentially(c *C) {
+	var delays []time.Duration
+
+	backingOff(s.clock, func() error {
+		return retryRecords(1, s.clock, func(indexes []int) ([]int, error) {
+			delays = append(delays, s.clock.Now().Sub(s.start))
+			return indexes, nil
+		})
+	})
+
+	c.Assert(delays, DeepEquals, []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond, 700 * time.Millisecond, 1500 * time.Millisecond})
+}
+
+func (s *RetrySuite) TestGivesUpAfterAttempts(c *C) {
+	attempts := 0
+
+	err := backingOff(s.clock, func() error {
+		return retryRecords(1, s.clock, func(indexes []int) ([]int, error) {
+			attempts++
+			return indexes, nil
+		})
+	})
+
+	c.Assert(err, NotNil)
+	c.Assert(attempts, Equals, recordAttempts)
+}
+
+func (s *RetrySuite) TestStopsOnRequestErrors(c *C) {
+	attempts := 0
+
+	err := retryRecords(1, s.clock, func(indexes []int) ([]int, error) {
+		attempts++
+		return nil, errors.New("request failed")
+	})
+
+	c.Assert(err, ErrorMatches, "request failed")
+	c.Assert(attempts, Equals, 1)
+}
+
+// backingOff runs f in the background, advancing the clock in steps of
+// recordBackoff while f waits to retry, and returns f's error.
+func backingOff(clock *test.FakeClock, f func() error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- f()
+	}()
+
+	for {
+		select {
+		case err := <-result:
+			return err
+		default:
+		}
+
+		if clock.WaitForWaiters(1, time.Millisecond) {
+			clock.Advance(recordBackoff)
+		}
+	}
+}
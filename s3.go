@@ -0,0 +1,65 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Sink archives undelivered batches to S3 as gzip-compressed
+// newline-delimited JSON, partitioned by group, stream and date.
+type S3Sink struct {
+	Bucket  string
+	Prefix  string
+	service *s3.S3
+}
+
+// NewS3Sink instantiates an S3Sink.
+func NewS3Sink(session *session.Session, bucket, prefix string) *S3Sink {
+	return &S3Sink{
+		Bucket:  bucket,
+		Prefix:  prefix,
+		service: s3.New(session),
+	}
+}
+
+// Write uploads a batch to S3.
+func (s *S3Sink) Write(dest Destination, events []*cloudwatchlogs.InputLogEvent, reason error) error {
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+	if err := encodeRecords(json.NewEncoder(writer), dest, events, reason); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	params := &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(dest, eventTime(events))),
+		Body:        bytes.NewReader(buffer.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	}
+
+	_, err := s.service.PutObject(params)
+
+	return err
+}
+
+func (s *S3Sink) key(dest Destination, t time.Time) string {
+	name := fmt.Sprintf("%d.ndjson.gz", time.Now().UnixNano())
+	key := path.Join(s.Prefix, dest.Group, dest.Stream, t.Format("2006/01/02"), name)
+
+	return strings.TrimPrefix(key, "/")
+}
@@ -0,0 +1,83 @@
+package cloudwatch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bradgignac/logspout-cloudwatch/test"
+	. "gopkg.in/check.v1"
+)
+
+type S3Suite struct {
+	mock *test.S3Mock
+	sink *S3Sink
+}
+
+var _ = Suite(&S3Suite{})
+
+func (s *S3Suite) SetUpTest(c *C) {
+	s.mock = test.NewS3Mock()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	config := aws.NewConfig().
+		WithCredentials(creds).
+		WithEndpoint(s.mock.URL).
+		WithRegion(REGION).
+		WithDisableSSL(true).
+		WithS3ForcePathStyle(true)
+	session := session.New(config)
+
+	s.sink = &S3Sink{
+		Bucket:  "archive",
+		Prefix:  "logs",
+		service: s3.New(session),
+	}
+}
+
+func (s *S3Suite) TearDownTest(c *C) {
+	s.mock.Close()
+}
+
+func (s *S3Suite) TestArchivesBatch(c *C) {
+	events := []*cloudwatchlogs.InputLogEvent{
+		{Message: aws.String("one"), Timestamp: aws.Int64(1462449600000)},
+		{Message: aws.String("two"), Timestamp: aws.Int64(1462449601000)},
+	}
+	dest := Destination{Group: "/app/web", Stream: "host"}
+
+	err := s.sink.Write(dest, events, errors.New("AccessDeniedException"))
+	objects := s.mock.GetObjects("archive")
+
+	c.Assert(err, IsNil)
+	c.Assert(objects, HasLen, 1)
+
+	for key, body := range objects {
+		c.Assert(strings.HasPrefix(key, "logs/app/web/host/2016/05/05/"), Equals, true)
+		c.Assert(strings.HasSuffix(key, ".ndjson.gz"), Equals, true)
+
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		c.Assert(err, IsNil)
+
+		var records []*SinkRecord
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			record := &SinkRecord{}
+			c.Assert(json.Unmarshal(scanner.Bytes(), record), IsNil)
+			records = append(records, record)
+		}
+
+		c.Assert(records, DeepEquals, []*SinkRecord{
+			{Group: "/app/web", Stream: "host", Timestamp: 1462449600000, Message: "one", Reason: "AccessDeniedException"},
+			{Group: "/app/web", Stream: "host", Timestamp: 1462449601000, Message: "two", Reason: "AccessDeniedException"},
+		})
+	}
+}
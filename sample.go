@@ -0,0 +1,139 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// sampleRateLabel overrides the route's sample rate for a single container.
+const sampleRateLabel = "cloudwatch.sample_rate"
+
+func sample(in <-chan Log, sampler *Sampler) <-chan Log {
+	return pipe(in, sampleStep(sampler))
+}
+
+func sampleStep(sampler *Sampler) step {
+	if sampler == nil {
+		return nil
+	}
+
+	return func(l Log) Log {
+		if !sampler.Keep(l) {
+			return nil
+		}
+
+		return l
+	}
+}
+
+// Sampler deterministically keeps one in every Rate messages. Messages are
+// hashed by a key so that related lines (e.g. a request ID) are either all
+// kept or all dropped.
+type Sampler struct {
+	Rate    int
+	Field   string
+	Pattern *regexp.Regexp
+	Never   *regexp.Regexp
+}
+
+// NewSampler creates a Sampler from route options. Without a rate, messages
+// are only sampled for containers that set a sample rate label.
+func NewSampler(rate, field, pattern, never string) (*Sampler, error) {
+	sampler := &Sampler{Rate: 1, Field: field}
+
+	if rate != "" {
+		r, err := strconv.Atoi(rate)
+		if err != nil || r < 1 {
+			return nil, fmt.Errorf("invalid sample rate: %s", rate)
+		}
+		sampler.Rate = r
+	}
+
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample pattern: %v", err)
+		}
+		sampler.Pattern = re
+	}
+
+	if never != "" {
+		re, err := regexp.Compile(never)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample exclusion pattern: %v", err)
+		}
+		sampler.Never = re
+	}
+
+	return sampler, nil
+}
+
+// Keep reports whether a message survives sampling. Kept messages are
+// annotated with the rate they were sampled at.
+func (s *Sampler) Keep(l Log) bool {
+	msg, ok := l.(*LogMessage)
+	if !ok {
+		return true
+	}
+
+	rate := s.rate(msg)
+	if rate <= 1 {
+		return true
+	}
+
+	if s.Never != nil && s.Never.MatchString(msg.Data) {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(s.key(msg)))
+
+	if hash.Sum32()%uint32(rate) != 0 {
+		return false
+	}
+
+	msg.SetField("sample_rate", rate)
+
+	return true
+}
+
+func (s *Sampler) rate(msg *LogMessage) int {
+	label, ok := msg.Labels()[sampleRateLabel]
+	if !ok {
+		return s.Rate
+	}
+
+	rate, err := strconv.Atoi(label)
+	if err != nil || rate < 1 {
+		log.Warnf("Ignoring invalid container sample rate - label: %s", label)
+		return s.Rate
+	}
+
+	return rate
+}
+
+// key returns the portion of a message that is hashed to make a sampling
+// decision, falling back to the entire message.
+func (s *Sampler) key(msg *LogMessage) string {
+	if s.Field != "" {
+		object := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(msg.Data), &object); err == nil {
+			if value, ok := object[s.Field]; ok {
+				return fmt.Sprint(value)
+			}
+		}
+	}
+
+	if s.Pattern != nil {
+		if match := s.Pattern.FindStringSubmatch(msg.Data); len(match) > 1 {
+			return match[1]
+		}
+	}
+
+	return msg.Data
+}
@@ -0,0 +1,96 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"regexp"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type SampleSuite struct{}
+
+var _ = Suite(&SampleSuite{})
+
+func (s *SampleSuite) TestPassesThroughWithoutSampler(c *C) {
+	input := make(chan Log)
+	output := sample(input, nil)
+
+	c.Assert(output, Equals, (<-chan Log)(input))
+}
+
+func (s *SampleSuite) TestKeepsFractionOfMessages(c *C) {
+	sampler := &Sampler{Rate: 10}
+	kept := 0
+
+	for i := 0; i < 10000; i++ {
+		msg := &LogMessage{Message: &router.Message{Data: fmt.Sprintf("line %d", i)}}
+		if sampler.Keep(msg) {
+			kept++
+		}
+	}
+
+	c.Assert(kept > 800 && kept < 1200, Equals, true)
+}
+
+func (s *SampleSuite) TestSamplingIsDeterministic(c *C) {
+	sampler := &Sampler{Rate: 4, Pattern: regexp.MustCompile(`request=(\w+)`)}
+
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("%d", i)
+		first := &LogMessage{Message: &router.Message{Data: "start request=" + id}}
+		second := &LogMessage{Message: &router.Message{Data: "end request=" + id}}
+
+		c.Assert(sampler.Keep(first), Equals, sampler.Keep(second))
+	}
+}
+
+func (s *SampleSuite) TestSamplesByJSONField(c *C) {
+	sampler := &Sampler{Rate: 4, Field: "id"}
+
+	for i := 0; i < 100; i++ {
+		first := &LogMessage{Message: &router.Message{Data: fmt.Sprintf(`{"id":%d,"step":1}`, i)}}
+		second := &LogMessage{Message: &router.Message{Data: fmt.Sprintf(`{"id":%d,"step":2}`, i)}}
+
+		c.Assert(sampler.Keep(first), Equals, sampler.Keep(second))
+	}
+}
+
+func (s *SampleSuite) TestAlwaysKeepsExcludedMessages(c *C) {
+	sampler := &Sampler{Rate: 1000, Never: regexp.MustCompile("ERROR")}
+
+	for i := 0; i < 100; i++ {
+		msg := &LogMessage{Message: &router.Message{Data: fmt.Sprintf("ERROR %d", i)}}
+		c.Assert(sampler.Keep(msg), Equals, true)
+	}
+}
+
+func (s *SampleSuite) TestAnnotatesKeptMessages(c *C) {
+	sampler := &Sampler{Rate: 2}
+
+	for i := 0; i < 10; i++ {
+		msg := &LogMessage{Message: &router.Message{Data: fmt.Sprintf("line %d", i)}}
+		if sampler.Keep(msg) {
+			c.Assert(msg.Fields["sample_rate"], Equals, 2)
+		}
+	}
+}
+
+func (s *SampleSuite) TestContainerLabelOverridesRate(c *C) {
+	sampler := &Sampler{Rate: 1000}
+	container := &docker.Container{
+		Config: &docker.Config{Labels: map[string]string{sampleRateLabel: "1"}},
+	}
+
+	for i := 0; i < 100; i++ {
+		msg := &LogMessage{Message: &router.Message{Container: container, Data: fmt.Sprintf("line %d", i)}}
+		c.Assert(sampler.Keep(msg), Equals, true)
+	}
+}
+
+func (s *SampleSuite) TestRejectsInvalidRate(c *C) {
+	_, err := NewSampler("0", "", "", "")
+
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,58 @@
+package cloudwatch
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// escapes matches ANSI CSI sequences (colors, cursor movement), OSC sequences
+// (window titles, hyperlinks) and other two-byte escape sequences.
+var escapes = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+func sanitize(in <-chan Log, enabled bool) <-chan Log {
+	return pipe(in, sanitizeStep(enabled))
+}
+
+func sanitizeStep(enabled bool) step {
+	if !enabled {
+		return nil
+	}
+
+	return func(l Log) Log {
+		if msg, ok := l.(*LogMessage); ok {
+			return sanitizeLog(msg)
+		}
+
+		return l
+	}
+}
+
+// sanitizeLog returns a copy of a log with a sanitized body. The underlying
+// message is copied because it is shared with other routes.
+func sanitizeLog(l *LogMessage) *LogMessage {
+	msg := *l.Message
+	msg.Data = sanitizeMessage(msg.Data)
+
+	return &LogMessage{Message: &msg, Fields: l.Fields, EventTime: l.EventTime}
+}
+
+// sanitizeMessage strips terminal escape sequences, normalizes line endings,
+// removes control characters and replaces invalid UTF-8.
+func sanitizeMessage(data string) string {
+	data = strings.ToValidUTF8(data, "\uFFFD")
+	data = escapes.ReplaceAllString(data, "")
+	data = strings.Replace(data, "\r\n", "\n", -1)
+
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+
+		if unicode.IsControl(r) {
+			return -1
+		}
+
+		return r
+	}, data)
+}
@@ -0,0 +1,51 @@
+package cloudwatch
+
+import (
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type SanitizeSuite struct{}
+
+var _ = Suite(&SanitizeSuite{})
+
+func (s *SanitizeSuite) TestPassesThroughWhenDisabled(c *C) {
+	input := make(chan Log)
+	output := sanitize(input, false)
+
+	c.Assert(output, Equals, (<-chan Log)(input))
+}
+
+func (s *SanitizeSuite) TestSanitizesMessages(c *C) {
+	input := make(chan Log, 1)
+	output := sanitize(input, true)
+
+	msg := &router.Message{Data: "\x1b[32mgreen\x1b[0m"}
+	input <- &LogMessage{Message: msg}
+	log := <-output
+
+	c.Assert(log.Body(), Equals, "green")
+	c.Assert(msg.Data, Equals, "\x1b[32mgreen\x1b[0m")
+}
+
+func (s *SanitizeSuite) TestStripsColorCodes(c *C) {
+	c.Assert(sanitizeMessage("\x1b[1;31mERROR\x1b[0m failed"), Equals, "ERROR failed")
+}
+
+func (s *SanitizeSuite) TestStripsOSCSequences(c *C) {
+	c.Assert(sanitizeMessage("\x1b]0;title\x07text"), Equals, "text")
+	c.Assert(sanitizeMessage("\x1b]8;;http://example.com\x1b\\link"), Equals, "link")
+}
+
+func (s *SanitizeSuite) TestNormalizesLineEndings(c *C) {
+	c.Assert(sanitizeMessage("one\r\ntwo\r\n"), Equals, "one\ntwo\n")
+}
+
+func (s *SanitizeSuite) TestRemovesControlCharacters(c *C) {
+	c.Assert(sanitizeMessage("10%\r50%\r100%\x00"), Equals, "10%50%100%")
+	c.Assert(sanitizeMessage("key\tvalue"), Equals, "key\tvalue")
+}
+
+func (s *SanitizeSuite) TestReplacesInvalidUTF8(c *C) {
+	c.Assert(sanitizeMessage("bad\xffbyte"), Equals, "bad\uFFFDbyte")
+}
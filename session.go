@@ -0,0 +1,214 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Assumed role credentials are refreshed this long before they expire.
+const credentialsExpiryWindow = time.Minute
+
+// NewSession creates the AWS session used by a route's clients. By default,
+// the session uses the SDK's default credential chain. Routes can instead use
+// static keys, a shared config profile, an assumed role or a web identity
+// token file.
+func NewSession(route *router.Route) (*session.Session, error) {
+	config, err := newConfig(route)
+	if err != nil {
+		return nil, err
+	}
+
+	options := session.Options{Config: *config}
+
+	if bundle := getopt(route, "aws_ca_bundle", ""); bundle != "" {
+		pem, err := readCABundle(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aws_ca_bundle: %v", err)
+		}
+		options.CustomCABundle = bytes.NewReader(pem)
+	}
+
+	if profile := getopt(route, "aws_profile", ""); profile != "" {
+		options.Profile = profile
+		options.SharedConfigState = session.SharedConfigEnable
+	}
+
+	key := getopt(route, "aws_access_key_id", "")
+	secret := getopt(route, "aws_secret_access_key", "")
+	if key != "" || secret != "" {
+		if key == "" || secret == "" {
+			return nil, errors.New("aws_access_key_id and aws_secret_access_key must be set together")
+		}
+
+		token := getopt(route, "aws_session_token", "")
+		options.Config.Credentials = credentials.NewStaticCredentials(key, secret, token)
+	}
+
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	role := getopt(route, "aws_role_arn", "")
+	name := getopt(route, "aws_role_session_name", "logspout-cloudwatch")
+	tokenFile := getopt(route, "aws_web_identity_token_file", "")
+
+	if tokenFile != "" {
+		if role == "" {
+			return nil, errors.New("aws_web_identity_token_file requires aws_role_arn")
+		}
+
+		creds := credentials.NewCredentials(newWebIdentityProvider(sess, role, name, tokenFile))
+		return sess.Copy(aws.NewConfig().WithCredentials(creds)), nil
+	}
+
+	if role != "" {
+		externalID := getopt(route, "aws_external_id", "")
+		creds := stscreds.NewCredentials(sess, role, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = name
+			p.ExpiryWindow = credentialsExpiryWindow
+
+			if externalID != "" {
+				p.ExternalID = aws.String(externalID)
+			}
+		})
+
+		return sess.Copy(aws.NewConfig().WithCredentials(creds)), nil
+	}
+
+	return sess, nil
+}
+
+// NewServiceConfig creates the configuration of the client for the service a
+// route writes to. A custom endpoint only applies to that client, so the STS,
+// S3 and CloudWatch clients the route also uses keep their default endpoints.
+func NewServiceConfig(route *router.Route) *aws.Config {
+	config := aws.NewConfig()
+
+	if endpoint := getopt(route, "aws_endpoint", ""); endpoint != "" {
+		config.WithEndpoint(endpoint)
+	}
+
+	return config
+}
+
+// newWebIdentityProvider creates a provider that assumes a role with the web
+// identity token in a file, refreshing credentials before they expire.
+func newWebIdentityProvider(sess *session.Session, role, name, tokenFile string) *stscreds.WebIdentityRoleProvider {
+	return stscreds.NewWebIdentityRoleProviderWithOptions(sts.New(sess), role, name, stscreds.FetchTokenPath(tokenFile), func(p *stscreds.WebIdentityRoleProvider) {
+		p.ExpiryWindow = credentialsExpiryWindow
+	})
+}
+
+// newConfig creates the endpoint and HTTP configuration of a route, returning
+// an error for invalid options so misconfiguration is reported at startup.
+func newConfig(route *router.Route) (*aws.Config, error) {
+	config := aws.NewConfig()
+
+	if endpoint := getopt(route, "aws_endpoint", ""); endpoint != "" {
+		if err := validateURL(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid aws_endpoint: %v", err)
+		}
+	}
+
+	if value := getopt(route, "aws_use_fips", ""); value != "" {
+		fips, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aws_use_fips: %v", err)
+		}
+		config.WithUseFIPSEndpoint(fips)
+	}
+
+	if value := getopt(route, "aws_disable_ssl", ""); value != "" {
+		disable, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aws_disable_ssl: %v", err)
+		}
+		config.WithDisableSSL(disable)
+	}
+
+	client, err := newHTTPClient(route)
+	if err != nil {
+		return nil, err
+	}
+
+	if client != nil {
+		config.WithHTTPClient(client)
+	}
+
+	return config, nil
+}
+
+// newHTTPClient creates an HTTP client with a route's proxy and timeout. It
+// returns nil when neither is configured.
+func newHTTPClient(route *router.Route) (*http.Client, error) {
+	proxy := getopt(route, "aws_proxy", "")
+	timeout := getopt(route, "aws_timeout", "")
+
+	if proxy == "" && timeout == "" {
+		return nil, nil
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	client := &http.Client{Transport: transport}
+
+	if proxy != "" {
+		if err := validateURL(proxy); err != nil {
+			return nil, fmt.Errorf("invalid aws_proxy: %v", err)
+		}
+
+		u, _ := url.Parse(proxy)
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aws_timeout: %v", err)
+		}
+		client.Timeout = d
+	}
+
+	return client, nil
+}
+
+// readCABundle reads a PEM bundle, checking that it contains certificates.
+func readCABundle(name string) ([]byte, error) {
+	pem, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", name)
+	}
+
+	return pem, nil
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%s is not an http or https URL", value)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package cloudwatch
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type SessionSuite struct{}
+
+var _ = Suite(&SessionSuite{})
+
+func (s *SessionSuite) TestStaticCredentials(c *C) {
+	route := &router.Route{Options: map[string]string{
+		"aws_access_key_id":     "id",
+		"aws_secret_access_key": "secret",
+	}}
+
+	session, err := NewSession(route)
+	c.Assert(err, IsNil)
+
+	creds, err := session.Config.Credentials.Get()
+	c.Assert(err, IsNil)
+	c.Assert(creds.AccessKeyID, Equals, "id")
+	c.Assert(creds.SecretAccessKey, Equals, "secret")
+}
+
+func (s *SessionSuite) TestRequiresBothStaticKeys(c *C) {
+	route := &router.Route{Options: map[string]string{"aws_access_key_id": "id"}}
+
+	_, err := NewSession(route)
+
+	c.Assert(err, NotNil)
+}
+
+func (s *SessionSuite) TestProfileCredentials(c *C) {
+	file := filepath.Join(c.MkDir(), "credentials")
+	ioutil.WriteFile(file, []byte("[team]\naws_access_key_id = team-id\naws_secret_access_key = team-secret\n"), 0600)
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", file)
+	defer os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+
+	route := &router.Route{Options: map[string]string{"aws_profile": "team"}}
+
+	session, err := NewSession(route)
+	c.Assert(err, IsNil)
+
+	creds, err := session.Config.Credentials.Get()
+	c.Assert(err, IsNil)
+	c.Assert(creds.AccessKeyID, Equals, "team-id")
+}
+
+func (s *SessionSuite) TestWebIdentityRequiresRole(c *C) {
+	route := &router.Route{Options: map[string]string{"aws_web_identity_token_file": "/var/run/token"}}
+
+	_, err := NewSession(route)
+
+	c.Assert(err, NotNil)
+}
+
+func (s *SessionSuite) TestWebIdentityRefreshesBeforeExpiry(c *C) {
+	session, err := NewSession(&router.Route{})
+	c.Assert(err, IsNil)
+
+	provider := newWebIdentityProvider(session, "arn:aws:iam::123456789012:role/logspout", "logspout", "/var/run/token")
+
+	c.Assert(provider.ExpiryWindow, Equals, credentialsExpiryWindow)
+}
+
+func (s *SessionSuite) TestEndpointAndTLSSettings(c *C) {
+	route := &router.Route{Options: map[string]string{
+		"aws_endpoint":    "http://localhost:4566",
+		"aws_use_fips":    "true",
+		"aws_disable_ssl": "true",
+		"aws_proxy":       "http://proxy:3128",
+		"aws_timeout":     "5s",
+	}}
+
+	session, err := NewSession(route)
+	c.Assert(err, IsNil)
+
+	c.Assert(session.Config.Endpoint, IsNil)
+	c.Assert(aws.StringValue(NewServiceConfig(route).Endpoint), Equals, "http://localhost:4566")
+	c.Assert(session.Config.UseFIPSEndpoint, Equals, endpoints.FIPSEndpointStateEnabled)
+	c.Assert(aws.BoolValue(session.Config.DisableSSL), Equals, true)
+	c.Assert(session.Config.HTTPClient.Timeout, Equals, 5*time.Second)
+
+	request, _ := http.NewRequest("GET", "https://logs.us-west-2.amazonaws.com", nil)
+	proxy, _ := session.Config.HTTPClient.Transport.(*http.Transport).Proxy(request)
+	c.Assert(proxy.String(), Equals, "http://proxy:3128")
+}
+
+func (s *SessionSuite) TestCABundle(c *C) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	bundle := filepath.Join(c.MkDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	ioutil.WriteFile(bundle, pem.EncodeToMemory(block), 0600)
+
+	route := &router.Route{Options: map[string]string{"aws_ca_bundle": bundle}}
+
+	session, err := NewSession(route)
+	c.Assert(err, IsNil)
+
+	resp, err := session.Config.HTTPClient.Get(server.URL)
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+}
+
+func (s *SessionSuite) TestRejectsInvalidSettings(c *C) {
+	invalid := []map[string]string{
+		{"aws_endpoint": "localhost:4566"},
+		{"aws_use_fips": "maybe"},
+		{"aws_disable_ssl": "maybe"},
+		{"aws_proxy": "ftp://proxy"},
+		{"aws_ca_bundle": "/does/not/exist.pem"},
+		{"aws_timeout": "soon"},
+	}
+
+	for _, options := range invalid {
+		_, err := NewSession(&router.Route{Options: options})
+		c.Assert(err, NotNil, Commentf("options: %v", options))
+	}
+}
@@ -0,0 +1,70 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// Sink receives batches that could not be delivered to CloudWatch, so that
+// they are not lost.
+type Sink interface {
+	Write(dest Destination, events []*cloudwatchlogs.InputLogEvent, reason error) error
+}
+
+// SinkRecord is the representation of an undelivered event written by sinks.
+type SinkRecord struct {
+	Group     string `json:"group"`
+	Stream    string `json:"stream"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// writeSinks hands an undelivered batch to every sink.
+func writeSinks(sinks []Sink, dest Destination, events []*cloudwatchlogs.InputLogEvent, reason error) {
+	for _, sink := range sinks {
+		if err := sink.Write(dest, events, reason); err != nil {
+			log.Errorf("Fallback write failed - group: %s, stream: %s, length: %d, error: %v", dest.Group, dest.Stream, len(events), err)
+		} else {
+			log.Infof("Fallback write succeeded - group: %s, stream: %s, length: %d", dest.Group, dest.Stream, len(events))
+		}
+	}
+}
+
+// encodeRecords writes events as newline-delimited JSON.
+func encodeRecords(encoder *json.Encoder, dest Destination, events []*cloudwatchlogs.InputLogEvent, reason error) error {
+	for _, event := range events {
+		record := &SinkRecord{
+			Group:     dest.Group,
+			Stream:    dest.Stream,
+			Timestamp: aws.Int64Value(event.Timestamp),
+			Message:   aws.StringValue(event.Message),
+		}
+
+		if reason != nil {
+			record.Reason = reason.Error()
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eventTime returns the time of the first event in a batch.
+func eventTime(events []*cloudwatchlogs.InputLogEvent) time.Time {
+	if len(events) == 0 {
+		return time.Now()
+	}
+
+	ms := aws.Int64Value(events[0].Timestamp)
+
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
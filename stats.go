@@ -0,0 +1,69 @@
+package cloudwatch
+
+import "sync/atomic"
+
+// Stats counts the logs delivered to CloudWatch by an adapter. When it has a
+// budget, snapshots include the bytes the budget holds.
+type Stats struct {
+	events     int64
+	bytes      int64
+	batches    int64
+	failures   int64
+	dropped    int64
+	overflowed int64
+	budget     *Budget
+}
+
+// StatsSnapshot holds the counts collected by Stats over a period, and the
+// bytes buffered at the end of it.
+type StatsSnapshot struct {
+	DeliveredEvents  int64
+	DeliveredBytes   int64
+	DeliveredBatches int64
+	FailedBatches    int64
+	DroppedEvents    int64
+	OverflowedEvents int64
+	BufferedBytes    int64
+}
+
+// Delivered records a successfully uploaded batch.
+func (s *Stats) Delivered(events, bytes int) {
+	atomic.AddInt64(&s.events, int64(events))
+	atomic.AddInt64(&s.bytes, int64(bytes))
+	atomic.AddInt64(&s.batches, 1)
+}
+
+// Failed records a batch that could not be uploaded.
+func (s *Stats) Failed(events int) {
+	atomic.AddInt64(&s.failures, 1)
+	atomic.AddInt64(&s.dropped, int64(events))
+}
+
+// Dropped records logs that were given up on before they were uploaded.
+func (s *Stats) Dropped(events int) {
+	atomic.AddInt64(&s.dropped, int64(events))
+}
+
+// Overflowed records logs dropped because the memory budget was exhausted.
+func (s *Stats) Overflowed(events int) {
+	atomic.AddInt64(&s.overflowed, int64(events))
+	atomic.AddInt64(&s.dropped, int64(events))
+}
+
+// Reset returns the counts collected since the last reset.
+func (s *Stats) Reset() StatsSnapshot {
+	snapshot := StatsSnapshot{
+		DeliveredEvents:  atomic.SwapInt64(&s.events, 0),
+		DeliveredBytes:   atomic.SwapInt64(&s.bytes, 0),
+		DeliveredBatches: atomic.SwapInt64(&s.batches, 0),
+		FailedBatches:    atomic.SwapInt64(&s.failures, 0),
+		DroppedEvents:    atomic.SwapInt64(&s.dropped, 0),
+		OverflowedEvents: atomic.SwapInt64(&s.overflowed, 0),
+	}
+
+	if s.budget != nil {
+		snapshot.BufferedBytes = s.budget.Used()
+	}
+
+	return snapshot
+}
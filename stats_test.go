@@ -0,0 +1,46 @@
+package cloudwatch
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type StatsSuite struct{}
+
+var _ = Suite(&StatsSuite{})
+
+func (s *StatsSuite) TestCountsDeliveries(c *C) {
+	stats := &Stats{}
+	stats.Delivered(2, 100)
+	stats.Delivered(3, 50)
+	stats.Failed(4)
+
+	c.Assert(stats.Reset(), Equals, StatsSnapshot{
+		DeliveredEvents:  5,
+		DeliveredBytes:   150,
+		DeliveredBatches: 2,
+		FailedBatches:    1,
+		DroppedEvents:    4,
+	})
+}
+
+func (s *StatsSuite) TestResetClearsCounts(c *C) {
+	stats := &Stats{}
+	stats.Delivered(2, 100)
+	stats.Reset()
+
+	c.Assert(stats.Reset(), Equals, StatsSnapshot{})
+}
+
+func (s *StatsSuite) TestCountsOverflowsAndBufferedBytes(c *C) {
+	budget := NewBudget()
+	budget.Acquire(64)
+
+	stats := &Stats{budget: budget}
+	stats.Overflowed(3)
+
+	c.Assert(stats.Reset(), Equals, StatsSnapshot{
+		DroppedEvents:    3,
+		OverflowedEvents: 3,
+		BufferedBytes:    64,
+	})
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock whose time only moves when it is advanced.
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	changed chan struct{}
+}
+
+type waiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// NewFakeClock instantiates a FakeClock set to a time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the current time of the clock.
+func (f *FakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.now
+}
+
+// After returns a channel that receives the time once the clock has been
+// advanced by a duration.
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	w := &waiter{deadline: f.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- f.now
+		return w.c
+	}
+
+	f.waiters = append(f.waiters, w)
+	f.notify()
+
+	return w.c
+}
+
+// Advance moves the clock forward, firing every timer that expires.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.now = f.now.Add(d)
+
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(f.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+
+		w.c <- f.now
+	}
+	f.waiters = waiters
+	f.notify()
+}
+
+// Waiters returns the number of timers that have not fired.
+func (f *FakeClock) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return len(f.waiters)
+}
+
+// WaitForWaiters blocks until at least n timers are waiting, so that a test
+// can advance the clock once the code under test has started waiting. It
+// returns false if that does not happen within the timeout.
+func (f *FakeClock) WaitForWaiters(n int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+
+	for {
+		f.mutex.Lock()
+		count, changed := len(f.waiters), f.changed
+		f.mutex.Unlock()
+
+		if count >= n {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func (f *FakeClock) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
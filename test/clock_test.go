@@ -0,0 +1,39 @@
+package test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type FakeClockSuite struct{}
+
+var _ = Suite(&FakeClockSuite{})
+
+func (s *FakeClockSuite) TestFiresTimersWhenAdvanced(c *C) {
+	start := time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	short := clock.After(time.Second)
+	long := clock.After(time.Minute)
+	c.Assert(clock.Waiters(), Equals, 2)
+
+	clock.Advance(time.Second)
+
+	c.Assert(<-short, Equals, start.Add(time.Second))
+	c.Assert(clock.Waiters(), Equals, 1)
+	select {
+	case <-long:
+		c.Fatal("timer fired early")
+	default:
+	}
+}
+
+func (s *FakeClockSuite) TestWaitsForWaiters(c *C) {
+	clock := NewFakeClock(time.Time{})
+
+	go clock.After(time.Second)
+
+	c.Assert(clock.WaitForWaiters(1, time.Second), Equals, true)
+	c.Assert(clock.WaitForWaiters(2, time.Millisecond), Equals, false)
+}
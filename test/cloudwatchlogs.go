@@ -1,62 +1,229 @@
 package test
 
 import (
+	"bytes"
 	"encoding/json"
-	"io"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	check "gopkg.in/check.v1"
 )
 
+// Limits of the PutLogEvents API from the CloudWatch Logs developer guide.
+// The size of a batch is the sum of its messages in bytes plus an overhead
+// for each event.
+const (
+	MaxBatchLength = 10000
+	MaxBatchSize   = 1048576
+	MaxEventSize   = 262144
+	EventOverhead  = 26
+	MaxBatchSpan   = 24 * time.Hour
+	MaxEventAge    = 14 * 24 * time.Hour
+	MaxEventSkew   = 2 * time.Hour
+)
+
+// retentionDays are the retention periods accepted by PutRetentionPolicy.
+var retentionDays = []int64{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
 // MockStream stores the state of a fake stream.
 type MockStream struct {
 	LogCount int
 	Token    int
+	Events   []*cloudwatchlogs.OutputLogEvent
+
+	// acceptedToken is the token the last batch was accepted with.
+	acceptedToken *string
 }
 
-// CloudWatchLogsMock mocks the CloudFront Logs API.
+// MockRequest is a request received by a mock.
+type MockRequest struct {
+	Action string
+	Group  string
+	Stream string
+	Body   []byte
+}
+
+// CloudWatchLogsMock mocks the CloudWatch Logs API. Groups must be created
+// before streams, and PutLogEvents enforces the limits of the real service.
+// The mock is safe for concurrent use, but fields must only be changed while
+// no requests are being served.
 type CloudWatchLogsMock struct {
 	*httptest.Server
 
+	mutex sync.Mutex
+
 	Groups  map[string]map[string]*MockStream
 	Streams []*cloudwatchlogs.LogStream
+
+	// Retention holds the retention policy of each group in days.
+	Retention map[string]int64
+
+	// Tokenless simulates current CloudWatch behavior, which ignores
+	// sequence tokens and no longer returns them.
+	Tokenless bool
+
+	// Now returns the time that event timestamps are checked against.
+	Now func() time.Time
+
+	// Faults are applied to matching calls in the order they were added.
+	Faults []*Fault
+
+	// Requests holds every request received, in order.
+	Requests []*MockRequest
+
+	// DiscardEvents counts accepted events without storing them or
+	// recording requests, so that load tests run in constant memory.
+	DiscardEvents bool
+
+	// OnAccept is called with the events accepted by each PutLogEvents call.
+	// It must not call the mock.
+	OnAccept func(group, stream string, events []*cloudwatchlogs.OutputLogEvent)
 }
 
-// NewCloudWatchLogsMock instantiates a mock CloudFront Logs server.
+// NewCloudWatchLogsMock instantiates a mock CloudWatch Logs server.
 func NewCloudWatchLogsMock() *CloudWatchLogsMock {
 	mock := &CloudWatchLogsMock{}
 	mock.Server = httptest.NewServer(mock)
 	mock.Streams = []*cloudwatchlogs.LogStream{}
 	mock.Groups = map[string]map[string]*MockStream{}
+	mock.Retention = map[string]int64{}
+	mock.Now = time.Now
 
 	return mock
 }
 
-// AddStream registers a new stream.
+// AddGroup registers a new group.
+func (m *CloudWatchLogsMock) AddGroup(group string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.addGroup(group)
+}
+
+// AddStream registers a new stream, creating its group if needed.
 func (m *CloudWatchLogsMock) AddStream(group, stream string) {
-	g, ok := m.Groups[group]
-	if !ok {
-		g = map[string]*MockStream{}
-		m.Groups[group] = g
-	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
-	s, ok := g[stream]
-	if !ok {
-		s = &MockStream{}
-		g[stream] = s
-	}
+	m.addStream(group, stream)
 }
 
 // GetStreams returns a list of streams in a group.
 func (m *CloudWatchLogsMock) GetStreams(group string) map[string]*MockStream {
-	return m.Groups[group]
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	streams := map[string]*MockStream{}
+	for name, s := range m.Groups[group] {
+		streams[name] = s
+	}
+
+	return streams
 }
 
 // GetStream returns a stream in a group.
 func (m *CloudWatchLogsMock) GetStream(group, stream string) *MockStream {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.getStream(group, stream)
+}
+
+// AddFault scripts a failure of the following matching calls.
+func (m *CloudWatchLogsMock) AddFault(fault *Fault) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.Faults = append(m.Faults, fault)
+}
+
+// GetEvents returns the messages stored in a stream, in the order they were
+// accepted.
+func (m *CloudWatchLogsMock) GetEvents(group, stream string) []string {
+	events := m.GetOutputEvents(group, stream)
+	messages := make([]string, len(events))
+
+	for i, event := range events {
+		messages[i] = aws.StringValue(event.Message)
+	}
+
+	return messages
+}
+
+// GetOutputEvents returns the events stored in a stream, in the order they
+// were accepted.
+func (m *CloudWatchLogsMock) GetOutputEvents(group, stream string) []*cloudwatchlogs.OutputLogEvent {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := m.getStream(group, stream)
+	if s == nil {
+		return nil
+	}
+
+	return append([]*cloudwatchlogs.OutputLogEvent{}, s.Events...)
+}
+
+// GetRequests returns the requests received for an action. An empty action
+// returns every request.
+func (m *CloudWatchLogsMock) GetRequests(action string) []*MockRequest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	requests := []*MockRequest{}
+	for _, r := range m.Requests {
+		if action == "" || r.Action == action {
+			requests = append(requests, r)
+		}
+	}
+
+	return requests
+}
+
+// AssertEvents asserts that a stream holds exactly these messages, in order.
+func (m *CloudWatchLogsMock) AssertEvents(c *check.C, group, stream string, messages ...string) {
+	if messages == nil {
+		messages = []string{}
+	}
+
+	events := m.GetEvents(group, stream)
+	if events == nil {
+		events = []string{}
+	}
+
+	c.Assert(events, check.DeepEquals, messages, check.Commentf("events in %s/%s", group, stream))
+}
+
+// AssertCalls asserts that an action was called a number of times.
+func (m *CloudWatchLogsMock) AssertCalls(c *check.C, action string, n int) {
+	c.Assert(m.GetRequests(action), check.HasLen, n, check.Commentf("calls to %s", action))
+}
+
+func (m *CloudWatchLogsMock) addGroup(group string) {
+	if _, ok := m.Groups[group]; !ok {
+		m.Groups[group] = map[string]*MockStream{}
+	}
+}
+
+func (m *CloudWatchLogsMock) addStream(group, stream string) {
+	m.addGroup(group)
+
+	g := m.Groups[group]
+	if _, ok := g[stream]; !ok {
+		g[stream] = &MockStream{}
+	}
+}
+
+func (m *CloudWatchLogsMock) getStream(group, stream string) *MockStream {
 	if group, ok := m.Groups[group]; ok {
 		return group[stream]
 	}
@@ -65,82 +232,606 @@ func (m *CloudWatchLogsMock) GetStream(group, stream string) *MockStream {
 }
 
 func (m *CloudWatchLogsMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	action := r.Header["X-Amz-Target"][0]
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.")
+
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	target := struct{ LogGroupName, LogStreamName string }{}
+	json.Unmarshal(body, &target)
+
+	m.mutex.Lock()
+	if !m.DiscardEvents {
+		m.Requests = append(m.Requests, &MockRequest{
+			Action: action,
+			Group:  target.LogGroupName,
+			Stream: target.LogStreamName,
+			Body:   body,
+		})
+	}
+
+	var fault *Fault
+	fault, m.Faults = takeFault(m.Faults, action, target.LogStreamName)
+	m.mutex.Unlock()
+
+	if fault == nil {
+		m.serve(action, w, r, &Fault{})
+		return
+	}
+
+	time.Sleep(fault.Latency)
+
+	switch {
+	case fault.Reset:
+		resetConnection(w)
+	case fault.Error != "" || fault.Status != 0:
+		writeFault(w, fault)
+	case fault.DropResponse:
+		m.serve(action, httptest.NewRecorder(), r, fault)
+		resetConnection(w)
+	default:
+		m.serve(action, w, r, fault)
+	}
+}
+
+func (m *CloudWatchLogsMock) serve(action string, w http.ResponseWriter, r *http.Request, fault *Fault) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
 	switch action {
-	case "Logs_20140328.DescribeLogStreams":
+	case "CreateLogGroup":
+		m.createLogGroup(w, r)
+	case "DescribeLogGroups":
+		m.describeLogGroups(w, r)
+	case "PutRetentionPolicy":
+		m.putRetentionPolicy(w, r)
+	case "DescribeLogStreams":
 		m.describeLogStreams(w, r)
-	case "Logs_20140328.CreateLogStream":
+	case "CreateLogStream":
 		m.createLogStream(w, r)
-	case "Logs_20140328.PutLogEvents":
-		m.putLogEvents(w, r)
+	case "PutLogEvents":
+		m.putLogEvents(w, r, fault)
+	case "GetLogEvents":
+		m.getLogEvents(w, r)
+	case "FilterLogEvents":
+		m.filterLogEvents(w, r)
+	default:
+		writeError(w, "UnknownOperationException", "Unknown operation.")
 	}
 }
 
+func (m *CloudWatchLogsMock) createLogGroup(w http.ResponseWriter, r *http.Request) {
+	data := &cloudwatchlogs.CreateLogGroupInput{}
+	readJSON(r.Body, data)
+
+	group := aws.StringValue(data.LogGroupName)
+	if group == "" {
+		writeError(w, "InvalidParameterException", "Log group name is required.")
+		return
+	}
+
+	if _, ok := m.Groups[group]; ok {
+		writeError(w, "ResourceAlreadyExistsException", "The specified log group already exists")
+		return
+	}
+
+	m.addGroup(group)
+	writeJSON(w, &map[string]interface{}{})
+}
+
+func (m *CloudWatchLogsMock) describeLogGroups(w http.ResponseWriter, r *http.Request) {
+	data := &cloudwatchlogs.DescribeLogGroupsInput{}
+	readJSON(r.Body, data)
+
+	names := []string{}
+	for name := range m.Groups {
+		if strings.HasPrefix(name, aws.StringValue(data.LogGroupNamePrefix)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	page, next := paginate(len(names), data.NextToken, data.Limit, 50)
+	groups := []interface{}{}
+
+	for _, name := range names[page[0]:page[1]] {
+		group := map[string]interface{}{"logGroupName": name}
+		if days, ok := m.Retention[name]; ok {
+			group["retentionInDays"] = days
+		}
+		groups = append(groups, group)
+	}
+
+	response := map[string]interface{}{"logGroups": groups}
+	if next != "" {
+		response["nextToken"] = next
+	}
+
+	writeJSON(w, &response)
+}
+
+func (m *CloudWatchLogsMock) putRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	data := &cloudwatchlogs.PutRetentionPolicyInput{}
+	readJSON(r.Body, data)
+
+	group := aws.StringValue(data.LogGroupName)
+	if _, ok := m.Groups[group]; !ok {
+		writeError(w, "ResourceNotFoundException", "The specified log group does not exist.")
+		return
+	}
+
+	days := aws.Int64Value(data.RetentionInDays)
+	for _, valid := range retentionDays {
+		if days == valid {
+			m.Retention[group] = days
+			writeJSON(w, &map[string]interface{}{})
+			return
+		}
+	}
+
+	writeError(w, "InvalidParameterException", fmt.Sprintf("Invalid retention period: %d", days))
+}
+
 func (m *CloudWatchLogsMock) describeLogStreams(w http.ResponseWriter, r *http.Request) {
 	data := &cloudwatchlogs.DescribeLogStreamsInput{}
-	m.readJSON(r.Body, data)
+	readJSON(r.Body, data)
 
 	group := aws.StringValue(data.LogGroupName)
+	if _, ok := m.Groups[group]; !ok {
+		writeError(w, "ResourceNotFoundException", "The specified log group does not exist.")
+		return
+	}
+
+	names := []string{}
+	for name := range m.Groups[group] {
+		if strings.HasPrefix(name, aws.StringValue(data.LogStreamNamePrefix)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	page, next := paginate(len(names), data.NextToken, data.Limit, 50)
 	streams := []interface{}{}
 
-	for n, s := range m.Groups[group] {
-		streams = append(streams, map[string]string{
-			"logStreamName":       n,
-			"uploadSequenceToken": strconv.Itoa(s.Token),
-		})
+	for _, name := range names[page[0]:page[1]] {
+		s := m.Groups[group][name]
+		stream := map[string]interface{}{"logStreamName": name}
+		if !m.Tokenless {
+			stream["uploadSequenceToken"] = strconv.Itoa(s.Token)
+		}
+		if len(s.Events) != 0 {
+			stream["firstEventTimestamp"] = aws.Int64Value(s.Events[0].Timestamp)
+			stream["lastEventTimestamp"] = aws.Int64Value(s.Events[len(s.Events)-1].Timestamp)
+		}
+		streams = append(streams, stream)
 	}
 
-	m.writeJSON(w, &map[string]interface{}{
-		"logStreams": streams,
-	})
+	response := map[string]interface{}{"logStreams": streams}
+	if next != "" {
+		response["nextToken"] = next
+	}
+
+	writeJSON(w, &response)
 }
 
 func (m *CloudWatchLogsMock) createLogStream(w http.ResponseWriter, r *http.Request) {
 	data := &cloudwatchlogs.CreateLogStreamInput{}
-	m.readJSON(r.Body, data)
+	readJSON(r.Body, data)
 
 	group := aws.StringValue(data.LogGroupName)
 	stream := aws.StringValue(data.LogStreamName)
 
-	m.AddStream(group, stream)
-	m.writeJSON(w, &map[string]interface{}{})
+	if _, ok := m.Groups[group]; !ok {
+		writeError(w, "ResourceNotFoundException", "The specified log group does not exist.")
+		return
+	}
+
+	if m.getStream(group, stream) != nil {
+		writeError(w, "ResourceAlreadyExistsException", "The specified log stream already exists")
+		return
+	}
+
+	m.addStream(group, stream)
+	writeJSON(w, &map[string]interface{}{})
 }
 
-func (m *CloudWatchLogsMock) putLogEvents(w http.ResponseWriter, r *http.Request) {
+func (m *CloudWatchLogsMock) putLogEvents(w http.ResponseWriter, r *http.Request, fault *Fault) {
 	data := &cloudwatchlogs.PutLogEventsInput{}
-	m.readJSON(r.Body, data)
+	readJSON(r.Body, data)
 
 	group := aws.StringValue(data.LogGroupName)
 	stream := aws.StringValue(data.LogStreamName)
 	token := aws.StringValue(data.SequenceToken)
 
-	s := m.GetStream(group, stream)
-	if strconv.Itoa(s.Token) != token && s.Token != 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		m.writeJSON(w, &map[string]interface{}{
-			"__type":  "InvalidSequenceTokenException",
-			"message": "The given sequenceToken is invalid.",
+	if _, ok := m.Groups[group]; !ok {
+		writeError(w, "ResourceNotFoundException", "The specified log group does not exist.")
+		return
+	}
+
+	s := m.getStream(group, stream)
+	if s == nil {
+		writeError(w, "ResourceNotFoundException", "The specified log stream does not exist.")
+		return
+	}
+
+	if err := validateEvents(data.LogEvents); err != "" {
+		writeError(w, "InvalidParameterException", err)
+		return
+	}
+
+	// A batch sent again with the token it was accepted with, e.g. because
+	// the response was lost, is reported as already accepted.
+	if !m.Tokenless && s.acceptedToken != nil && token == *s.acceptedToken {
+		writeError(w, "DataAlreadyAcceptedException", "The given batch of log events has already been accepted.")
+		return
+	}
+
+	if !m.Tokenless && strconv.Itoa(s.Token) != token && s.Token != 0 {
+		writeError(w, "InvalidSequenceTokenException", "The given sequenceToken is invalid.")
+		return
+	}
+
+	rejected := m.rejectEvents(group, data.LogEvents)
+	if fault.TooOld > rejected.tooOldEnd {
+		rejected.tooOldEnd = fault.TooOld
+		if rejected.tooOldEnd > len(data.LogEvents) {
+			rejected.tooOldEnd = len(data.LogEvents)
+		}
+	}
+	now := m.Now().UnixNano() / int64(time.Millisecond)
+	accepted := []*cloudwatchlogs.OutputLogEvent{}
+
+	for i, event := range data.LogEvents {
+		if rejected.index(i) {
+			continue
+		}
+
+		accepted = append(accepted, &cloudwatchlogs.OutputLogEvent{
+			Message:       event.Message,
+			Timestamp:     event.Timestamp,
+			IngestionTime: aws.Int64(now),
 		})
+	}
+
+	s.LogCount += len(accepted)
+	if !m.DiscardEvents {
+		s.Events = append(s.Events, accepted...)
+	}
+
+	if m.OnAccept != nil {
+		m.OnAccept(group, stream, accepted)
+	}
+
+	response := map[string]interface{}{}
+	if !rejected.empty() {
+		response["rejectedLogEventsInfo"] = rejected.info()
+	}
+
+	if !m.Tokenless {
+		s.acceptedToken = aws.String(token)
+		s.Token++
+		response["nextSequenceToken"] = strconv.Itoa(s.Token)
+	}
+
+	writeJSON(w, &response)
+}
+
+func (m *CloudWatchLogsMock) getLogEvents(w http.ResponseWriter, r *http.Request) {
+	data := &cloudwatchlogs.GetLogEventsInput{}
+	readJSON(r.Body, data)
+
+	group := aws.StringValue(data.LogGroupName)
+	if _, ok := m.Groups[group]; !ok {
+		writeError(w, "ResourceNotFoundException", "The specified log group does not exist.")
+		return
+	}
+
+	s := m.getStream(group, aws.StringValue(data.LogStreamName))
+	if s == nil {
+		writeError(w, "ResourceNotFoundException", "The specified log stream does not exist.")
 		return
 	}
 
-	s.LogCount += len(data.LogEvents)
-	s.Token++
+	events := []*cloudwatchlogs.OutputLogEvent{}
+	for _, event := range s.Events {
+		if inRange(event.Timestamp, data.StartTime, data.EndTime) {
+			events = append(events, event)
+		}
+	}
+
+	// Tokens hold the position in the filtered events that the next page
+	// starts (forward) or ends (backward) at. Without a token, the newest
+	// events are returned unless reading from the head.
+	limit := int(aws.Int64Value(data.Limit))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
 
-	m.writeJSON(w, &map[string]interface{}{
-		"nextSequenceToken": strconv.Itoa(s.Token),
+	start, end := 0, len(events)
+	token := aws.StringValue(data.NextToken)
+
+	switch {
+	case strings.HasPrefix(token, "f/"):
+		start, _ = strconv.Atoi(token[2:])
+		end = start + limit
+	case strings.HasPrefix(token, "b/"):
+		end, _ = strconv.Atoi(token[2:])
+		start = end - limit
+	case aws.BoolValue(data.StartFromHead):
+		end = limit
+	default:
+		start = end - limit
+	}
+
+	start, end = clamp(start, len(events)), clamp(end, len(events))
+	if start > end {
+		start = end
+	}
+
+	writeJSON(w, &map[string]interface{}{
+		"events":            outputEvents(events[start:end], ""),
+		"nextForwardToken":  fmt.Sprintf("f/%d", end),
+		"nextBackwardToken": fmt.Sprintf("b/%d", start),
+	})
+}
+
+func (m *CloudWatchLogsMock) filterLogEvents(w http.ResponseWriter, r *http.Request) {
+	data := &cloudwatchlogs.FilterLogEventsInput{}
+	readJSON(r.Body, data)
+
+	group := aws.StringValue(data.LogGroupName)
+	if _, ok := m.Groups[group]; !ok {
+		writeError(w, "ResourceNotFoundException", "The specified log group does not exist.")
+		return
+	}
+
+	names := []string{}
+	if len(data.LogStreamNames) != 0 {
+		for _, name := range aws.StringValueSlice(data.LogStreamNames) {
+			if _, ok := m.Groups[group][name]; ok {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for name := range m.Groups[group] {
+			if strings.HasPrefix(name, aws.StringValue(data.LogStreamNamePrefix)) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	type match struct {
+		stream string
+		event  *cloudwatchlogs.OutputLogEvent
+	}
+
+	matches := []match{}
+	searched := []interface{}{}
+
+	for _, name := range names {
+		for _, event := range m.Groups[group][name].Events {
+			if inRange(event.Timestamp, data.StartTime, data.EndTime) && matchPattern(aws.StringValue(data.FilterPattern), aws.StringValue(event.Message)) {
+				matches = append(matches, match{stream: name, event: event})
+			}
+		}
+
+		searched = append(searched, map[string]interface{}{
+			"logStreamName":      name,
+			"searchedCompletely": true,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return aws.Int64Value(matches[i].event.Timestamp) < aws.Int64Value(matches[j].event.Timestamp)
 	})
+
+	page, next := paginate(len(matches), data.NextToken, data.Limit, 10000)
+	events := []interface{}{}
+
+	for i, match := range matches[page[0]:page[1]] {
+		event := outputEvents([]*cloudwatchlogs.OutputLogEvent{match.event}, match.stream)[0]
+		event["eventId"] = strconv.Itoa(page[0] + i)
+		events = append(events, event)
+	}
+
+	response := map[string]interface{}{
+		"events":             events,
+		"searchedLogStreams": searched,
+	}
+	if next != "" {
+		response["nextToken"] = next
+	}
+
+	writeJSON(w, &response)
+}
+
+// validateEvents checks a batch against the limits that cause CloudWatch to
+// reject the entire request.
+func validateEvents(events []*cloudwatchlogs.InputLogEvent) string {
+	if len(events) == 0 {
+		return "At least one log event is required."
+	}
+
+	if len(events) > MaxBatchLength {
+		return fmt.Sprintf("The batch of log events must contain at most %d events.", MaxBatchLength)
+	}
+
+	size := 0
+	for i, event := range events {
+		eventSize := len(aws.StringValue(event.Message)) + EventOverhead
+		if eventSize > MaxEventSize {
+			return "Log event too large."
+		}
+		size += eventSize
+
+		if i > 0 && aws.Int64Value(event.Timestamp) < aws.Int64Value(events[i-1].Timestamp) {
+			return "Log events in a single PutLogEvents request must be in chronological order."
+		}
+	}
+
+	if size > MaxBatchSize {
+		return "Upload too large."
+	}
+
+	first := aws.Int64Value(events[0].Timestamp)
+	last := aws.Int64Value(events[len(events)-1].Timestamp)
+	if time.Duration(last-first)*time.Millisecond > MaxBatchSpan {
+		return "The batch of log events in a single PutLogEvents request cannot span more than 24 hours."
+	}
+
+	return ""
 }
 
-func (m *CloudWatchLogsMock) readJSON(body io.ReadCloser, data interface{}) error {
-	decoder := json.NewDecoder(body)
-	return decoder.Decode(data)
+// rejectedEvents holds the indexes of a chronological batch that CloudWatch
+// accepts the request for but does not store. Events before the end indexes
+// are too old or expired, and events from the start index are too new.
+type rejectedEvents struct {
+	tooOldEnd  int
+	expiredEnd int
+	tooNew     int
+	length     int
 }
 
-func (m *CloudWatchLogsMock) writeJSON(w http.ResponseWriter, data interface{}) {
-	err := json.NewEncoder(w).Encode(data)
-	if err != nil {
-		http.Error(w, "Internal Server Error", 500)
+func (m *CloudWatchLogsMock) rejectEvents(group string, events []*cloudwatchlogs.InputLogEvent) *rejectedEvents {
+	now := m.Now()
+	rejected := &rejectedEvents{tooNew: len(events), length: len(events)}
+
+	oldest := now.Add(-MaxEventAge)
+	expired := time.Time{}
+	if days, ok := m.Retention[group]; ok {
+		expired = now.Add(-time.Duration(days) * 24 * time.Hour)
+	}
+
+	for i, event := range events {
+		t := time.Unix(0, aws.Int64Value(event.Timestamp)*int64(time.Millisecond))
+
+		if t.Before(oldest) {
+			rejected.tooOldEnd = i + 1
+		}
+		if t.Before(expired) {
+			rejected.expiredEnd = i + 1
+		}
+		if t.After(now.Add(MaxEventSkew)) && i < rejected.tooNew {
+			rejected.tooNew = i
+		}
 	}
+
+	return rejected
+}
+
+func (r *rejectedEvents) index(i int) bool {
+	return i < r.tooOldEnd || i < r.expiredEnd || i >= r.tooNew
+}
+
+func (r *rejectedEvents) empty() bool {
+	return r.tooOldEnd == 0 && r.expiredEnd == 0 && r.tooNew == r.length
+}
+
+func (r *rejectedEvents) info() map[string]interface{} {
+	info := map[string]interface{}{}
+	if r.tooOldEnd != 0 {
+		info["tooOldLogEventEndIndex"] = r.tooOldEnd
+	}
+	if r.expiredEnd != 0 {
+		info["expiredLogEventEndIndex"] = r.expiredEnd
+	}
+	if r.tooNew != r.length {
+		info["tooNewLogEventStartIndex"] = r.tooNew
+	}
+
+	return info
+}
+
+// matchPattern implements the unstructured subset of the filter pattern
+// syntax, where every term must appear in the message. Quoted terms may
+// contain spaces.
+func matchPattern(pattern, message string) bool {
+	for _, term := range patternTerms(pattern) {
+		if !strings.Contains(message, term) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func patternTerms(pattern string) []string {
+	terms := []string{}
+
+	for i, part := range strings.Split(pattern, `"`) {
+		if i%2 == 1 {
+			if part != "" {
+				terms = append(terms, part)
+			}
+			continue
+		}
+
+		terms = append(terms, strings.Fields(part)...)
+	}
+
+	return terms
+}
+
+func inRange(timestamp, start, end *int64) bool {
+	t := aws.Int64Value(timestamp)
+
+	if start != nil && t < *start {
+		return false
+	}
+
+	// The end time is exclusive.
+	if end != nil && t >= *end {
+		return false
+	}
+
+	return true
+}
+
+func outputEvents(events []*cloudwatchlogs.OutputLogEvent, stream string) []map[string]interface{} {
+	output := make([]map[string]interface{}, len(events))
+
+	for i, event := range events {
+		output[i] = map[string]interface{}{
+			"message":       aws.StringValue(event.Message),
+			"timestamp":     aws.Int64Value(event.Timestamp),
+			"ingestionTime": aws.Int64Value(event.IngestionTime),
+		}
+		if stream != "" {
+			output[i]["logStreamName"] = stream
+		}
+	}
+
+	return output
+}
+
+// paginate returns the bounds of the page of a list that starts at the
+// offset in a token, and the token of the following page.
+func paginate(length int, token *string, limit *int64, max int) ([2]int, string) {
+	start, _ := strconv.Atoi(aws.StringValue(token))
+	start = clamp(start, length)
+
+	n := int(aws.Int64Value(limit))
+	if n <= 0 || n > max {
+		n = max
+	}
+
+	end := clamp(start+n, length)
+	next := ""
+	if end < length {
+		next = strconv.Itoa(end)
+	}
+
+	return [2]int{start, end}, next
+}
+
+func clamp(i, length int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+
+	return i
 }
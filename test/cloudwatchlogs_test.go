@@ -0,0 +1,195 @@
+package test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	. "gopkg.in/check.v1"
+)
+
+func TestCloudWatchLogsMock(t *testing.T) {
+	TestingT(t)
+}
+
+type CloudWatchLogsMockSuite struct {
+	mock    *CloudWatchLogsMock
+	service *cloudwatchlogs.CloudWatchLogs
+}
+
+var _ = Suite(&CloudWatchLogsMockSuite{})
+
+func (s *CloudWatchLogsMockSuite) SetUpTest(c *C) {
+	s.mock = NewCloudWatchLogsMock()
+	s.mock.Now = func() time.Time { return time.Unix(1462449600, 0) }
+	s.mock.Tokenless = true
+
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	config := aws.NewConfig().
+		WithCredentials(creds).
+		WithEndpoint(s.mock.URL).
+		WithRegion("us-west-2").
+		WithDisableSSL(true).
+		WithMaxRetries(0)
+	s.service = cloudwatchlogs.New(session.New(config))
+}
+
+func (s *CloudWatchLogsMockSuite) TearDownTest(c *C) {
+	s.mock.Close()
+}
+
+func (s *CloudWatchLogsMockSuite) TestCreatesAndDescribesGroups(c *C) {
+	_, err := s.service.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String("group")})
+	c.Assert(err, IsNil)
+
+	_, err = s.service.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String("group")})
+	c.Assert(err, ErrorMatches, "ResourceAlreadyExistsException: .*")
+
+	_, err = s.service.PutRetentionPolicy(&cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    aws.String("group"),
+		RetentionInDays: aws.Int64(7),
+	})
+	c.Assert(err, IsNil)
+
+	resp, err := s.service.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{})
+	c.Assert(err, IsNil)
+	c.Assert(resp.LogGroups, HasLen, 1)
+	c.Assert(aws.StringValue(resp.LogGroups[0].LogGroupName), Equals, "group")
+	c.Assert(aws.Int64Value(resp.LogGroups[0].RetentionInDays), Equals, int64(7))
+}
+
+func (s *CloudWatchLogsMockSuite) TestRejectsInvalidRetention(c *C) {
+	s.mock.AddGroup("group")
+
+	_, err := s.service.PutRetentionPolicy(&cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    aws.String("group"),
+		RetentionInDays: aws.Int64(2),
+	})
+
+	c.Assert(err, ErrorMatches, "InvalidParameterException: .*")
+}
+
+func (s *CloudWatchLogsMockSuite) TestRejectsBatchesSpanningADay(c *C) {
+	s.mock.AddStream("group", "stream")
+
+	_, err := s.put(0, int64(25*time.Hour/time.Millisecond))
+
+	c.Assert(err, ErrorMatches, "InvalidParameterException: .*24 hours.*")
+}
+
+func (s *CloudWatchLogsMockSuite) TestReportsRejectedEvents(c *C) {
+	s.mock.AddStream("group", "stream")
+
+	day := int64(24 * time.Hour / time.Millisecond)
+
+	resp, err := s.put(-14*day-1000, -14*day+1000)
+	c.Assert(err, IsNil)
+	c.Assert(aws.Int64Value(resp.RejectedLogEventsInfo.TooOldLogEventEndIndex), Equals, int64(1))
+
+	resp, err = s.put(0, day/2)
+	c.Assert(err, IsNil)
+	c.Assert(aws.Int64Value(resp.RejectedLogEventsInfo.TooNewLogEventStartIndex), Equals, int64(1))
+	c.Assert(s.mock.GetStream("group", "stream").LogCount, Equals, 2)
+}
+
+func (s *CloudWatchLogsMockSuite) TestReadsEvents(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.put(-3000, -2000, -1000)
+
+	resp, err := s.service.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("stream"),
+		StartFromHead: aws.Bool(true),
+		Limit:         aws.Int64(2),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Events, HasLen, 2)
+
+	resp, err = s.service.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("stream"),
+		NextToken:     resp.NextForwardToken,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Events, HasLen, 1)
+	c.Assert(aws.StringValue(resp.Events[0].Message), Equals, "event 2")
+}
+
+func (s *CloudWatchLogsMockSuite) TestFiltersEvents(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.put(-3000, -2000, -1000)
+
+	resp, err := s.service.FilterLogEvents(&cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		FilterPattern: aws.String(`"event 1"`),
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(resp.Events, HasLen, 1)
+	c.Assert(aws.StringValue(resp.Events[0].LogStreamName), Equals, "stream")
+	c.Assert(aws.StringValue(resp.Events[0].Message), Equals, "event 1")
+}
+
+func (s *CloudWatchLogsMockSuite) TestRejectsUnknownOperations(c *C) {
+	_, err := s.service.DeleteLogGroup(&cloudwatchlogs.DeleteLogGroupInput{LogGroupName: aws.String("group")})
+
+	c.Assert(err, ErrorMatches, "(?s)UnknownOperationException: .*")
+}
+
+func (s *CloudWatchLogsMockSuite) TestServesConcurrentRequests(c *C) {
+	s.mock.AddStream("group", "stream")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.put(0)
+		}()
+	}
+	wg.Wait()
+
+	s.mock.AssertCalls(c, "PutLogEvents", 20)
+	c.Assert(s.mock.GetEvents("group", "stream"), HasLen, 20)
+}
+
+func (s *CloudWatchLogsMockSuite) TestRecordsRequestsAndEvents(c *C) {
+	s.mock.AddStream("group", "stream")
+	s.put(-2000, -1000)
+
+	requests := s.mock.GetRequests("PutLogEvents")
+	c.Assert(requests, HasLen, 1)
+	c.Assert(requests[0].Group, Equals, "group")
+	c.Assert(requests[0].Stream, Equals, "stream")
+
+	events := s.mock.GetOutputEvents("group", "stream")
+	c.Assert(events, HasLen, 2)
+	c.Assert(aws.Int64Value(events[1].Timestamp)-aws.Int64Value(events[0].Timestamp), Equals, int64(1000))
+
+	s.mock.AssertEvents(c, "group", "stream", "event 0", "event 1")
+	s.mock.AssertEvents(c, "group", "missing")
+}
+
+// put uploads an event for each offset in milliseconds from the mock's time.
+func (s *CloudWatchLogsMockSuite) put(offsets ...int64) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	now := s.mock.Now().UnixNano() / int64(time.Millisecond)
+	events := []*cloudwatchlogs.InputLogEvent{}
+
+	for i, offset := range offsets {
+		events = append(events, &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String("event " + strconv.Itoa(i)),
+			Timestamp: aws.Int64(now + offset),
+		})
+	}
+
+	return s.service.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("stream"),
+		LogEvents:     events,
+	})
+}
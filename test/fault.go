@@ -0,0 +1,105 @@
+package test
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Fault scripts a failure of a mock. Faults apply to calls of an action on a
+// stream, and are used up after Times calls.
+type Fault struct {
+	// Action is the API action the fault applies to, e.g. PutLogEvents. An
+	// empty action matches every action.
+	Action string
+
+	// Stream is the stream the fault applies to. An empty stream matches
+	// every stream.
+	Stream string
+
+	// Times is the number of calls the fault applies to. A fault with no
+	// times applies to every call.
+	Times int
+
+	// Latency delays the response.
+	Latency time.Duration
+
+	// Error is the type of error returned, e.g. ThrottlingException.
+	Error string
+
+	// Status is the HTTP status of the error, which defaults to 400.
+	Status int
+
+	// Reset closes the connection without handling the request.
+	Reset bool
+
+	// DropResponse handles the request, then closes the connection without
+	// responding, as if the response was lost.
+	DropResponse bool
+
+	// TooOld rejects this many of the first events of a batch as too old.
+	TooOld int
+}
+
+func (f *Fault) matches(action, stream string) bool {
+	return (f.Action == "" || f.Action == action) && (f.Stream == "" || f.Stream == stream)
+}
+
+// takeFault returns the first fault that matches a call, and removes faults
+// that have been used up.
+func takeFault(faults []*Fault, action, stream string) (*Fault, []*Fault) {
+	for i, f := range faults {
+		if !f.matches(action, stream) {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				faults = append(faults[:i:i], faults[i+1:]...)
+			}
+		}
+
+		return f, faults
+	}
+
+	return nil, faults
+}
+
+// writeFault writes the error of a fault.
+func writeFault(w http.ResponseWriter, f *Fault) {
+	status := f.Status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+
+	errorType := f.Error
+	if errorType == "" {
+		errorType = "InternalFailure"
+	}
+
+	w.WriteHeader(status)
+	writeJSON(w, &map[string]interface{}{
+		"__type":  errorType,
+		"message": "Injected fault.",
+	})
+}
+
+// resetConnection closes the connection of a request without responding.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic("response does not support closing the connection")
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(err)
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+
+	conn.Close()
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/firehose"
+)
+
+// FirehoseMock mocks the Kinesis Data Firehose API.
+type FirehoseMock struct {
+	*httptest.Server
+
+	// Streams holds the records delivered to each delivery stream.
+	Streams map[string][][]byte
+
+	// FailRecords is the number of records that fail in the following
+	// PutRecordBatch calls.
+	FailRecords int
+}
+
+// NewFirehoseMock instantiates a mock Firehose server.
+func NewFirehoseMock() *FirehoseMock {
+	mock := &FirehoseMock{}
+	mock.Server = httptest.NewServer(mock)
+	mock.Streams = map[string][][]byte{}
+
+	return mock
+}
+
+// GetRecords returns the records delivered to a delivery stream.
+func (m *FirehoseMock) GetRecords(stream string) [][]byte {
+	return m.Streams[stream]
+}
+
+func (m *FirehoseMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("X-Amz-Target") {
+	case "Firehose_20150804.PutRecordBatch":
+		m.putRecordBatch(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *FirehoseMock) putRecordBatch(w http.ResponseWriter, r *http.Request) {
+	data := &firehose.PutRecordBatchInput{}
+	readJSON(r.Body, data)
+
+	stream := aws.StringValue(data.DeliveryStreamName)
+	responses := []interface{}{}
+	failed := 0
+
+	for i, record := range data.Records {
+		if m.FailRecords > 0 {
+			m.FailRecords--
+			failed++
+			responses = append(responses, map[string]string{
+				"ErrorCode":    "ServiceUnavailableException",
+				"ErrorMessage": "Slow down.",
+			})
+			continue
+		}
+
+		m.Streams[stream] = append(m.Streams[stream], record.Data)
+		responses = append(responses, map[string]string{
+			"RecordId": strconv.Itoa(i),
+		})
+	}
+
+	writeJSON(w, &map[string]interface{}{
+		"FailedPutCount":   failed,
+		"Encrypted":        false,
+		"RequestResponses": responses,
+	})
+}
@@ -0,0 +1,28 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+func readJSON(body io.ReadCloser, data interface{}) error {
+	decoder := json.NewDecoder(body)
+	return decoder.Decode(data)
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		http.Error(w, "Internal Server Error", 500)
+	}
+}
+
+// writeError writes an error in the format of the AWS JSON protocol.
+func writeError(w http.ResponseWriter, errorType, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	writeJSON(w, &map[string]interface{}{
+		"__type":  errorType,
+		"message": message,
+	})
+}
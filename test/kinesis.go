@@ -0,0 +1,86 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// KinesisRecord stores a record delivered to a fake data stream.
+type KinesisRecord struct {
+	Data         []byte
+	PartitionKey string
+}
+
+// KinesisMock mocks the Kinesis Data Streams API.
+type KinesisMock struct {
+	*httptest.Server
+
+	// Streams holds the records delivered to each data stream.
+	Streams map[string][]*KinesisRecord
+
+	// FailRecords is the number of records that fail in the following
+	// PutRecords calls.
+	FailRecords int
+}
+
+// NewKinesisMock instantiates a mock Kinesis server.
+func NewKinesisMock() *KinesisMock {
+	mock := &KinesisMock{}
+	mock.Server = httptest.NewServer(mock)
+	mock.Streams = map[string][]*KinesisRecord{}
+
+	return mock
+}
+
+// GetRecords returns the records delivered to a data stream.
+func (m *KinesisMock) GetRecords(stream string) []*KinesisRecord {
+	return m.Streams[stream]
+}
+
+func (m *KinesisMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get("X-Amz-Target") {
+	case "Kinesis_20131202.PutRecords":
+		m.putRecords(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *KinesisMock) putRecords(w http.ResponseWriter, r *http.Request) {
+	data := &kinesis.PutRecordsInput{}
+	readJSON(r.Body, data)
+
+	stream := aws.StringValue(data.StreamName)
+	results := []interface{}{}
+	failed := 0
+
+	for _, record := range data.Records {
+		if m.FailRecords > 0 {
+			m.FailRecords--
+			failed++
+			results = append(results, map[string]string{
+				"ErrorCode":    "ProvisionedThroughputExceededException",
+				"ErrorMessage": "Rate exceeded for shard shardId-000000000000.",
+			})
+			continue
+		}
+
+		m.Streams[stream] = append(m.Streams[stream], &KinesisRecord{
+			Data:         record.Data,
+			PartitionKey: aws.StringValue(record.PartitionKey),
+		})
+		results = append(results, map[string]string{
+			"SequenceNumber": strconv.Itoa(len(m.Streams[stream])),
+			"ShardId":        "shardId-000000000000",
+		})
+	}
+
+	writeJSON(w, &map[string]interface{}{
+		"FailedRecordCount": failed,
+		"Records":           results,
+	})
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// S3Mock mocks the S3 API for path-style requests.
+type S3Mock struct {
+	*httptest.Server
+
+	// Objects holds the contents of objects keyed by bucket and key.
+	Objects map[string][]byte
+}
+
+// NewS3Mock instantiates a mock S3 server.
+func NewS3Mock() *S3Mock {
+	mock := &S3Mock{}
+	mock.Server = httptest.NewServer(mock)
+	mock.Objects = map[string][]byte{}
+
+	return mock
+}
+
+// GetObjects returns the contents of objects in a bucket, keyed by key.
+func (m *S3Mock) GetObjects(bucket string) map[string][]byte {
+	objects := map[string][]byte{}
+
+	for k, v := range m.Objects {
+		if strings.HasPrefix(k, bucket+"/") {
+			objects[strings.TrimPrefix(k, bucket+"/")] = v
+		}
+	}
+
+	return objects
+}
+
+func (m *S3Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		m.putObject(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *S3Mock) putObject(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Internal Server Error", 500)
+		return
+	}
+
+	m.Objects[strings.TrimPrefix(r.URL.Path, "/")] = body
+	w.Header().Set("ETag", `"etag"`)
+}
@@ -0,0 +1,176 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxSkew is how far an extracted timestamp may be from the time
+// Docker read the line before it is considered implausible.
+const defaultMaxSkew = 24 * time.Hour
+
+// maxFutureSkew is how far ahead of the Docker timestamp an extracted
+// timestamp may be, as CloudWatch rejects events more than 2 hours in the
+// future.
+const maxFutureSkew = 2 * time.Hour
+
+func extractTimestamps(in <-chan Log, extractor *TimestampExtractor) <-chan Log {
+	return pipe(in, timestampStep(extractor))
+}
+
+func timestampStep(extractor *TimestampExtractor) step {
+	if extractor == nil {
+		return nil
+	}
+
+	return func(l Log) Log {
+		if msg, ok := l.(*LogMessage); ok {
+			extractor.Extract(msg)
+		}
+
+		return l
+	}
+}
+
+// TimestampExtractor reads event timestamps from the contents of a log line,
+// either from a JSON field or from the first capture group of a pattern.
+type TimestampExtractor struct {
+	Field    string
+	Pattern  *regexp.Regexp
+	Layouts  []string
+	Location *time.Location
+	MaxSkew  time.Duration
+}
+
+// NewTimestampExtractor creates a TimestampExtractor from route options. It
+// returns nil when neither a field nor a pattern is configured. Layouts are
+// pipe-separated and may be rfc3339, epoch, epoch_millis or a Go layout.
+func NewTimestampExtractor(field, pattern, layouts, zone, skew string) (*TimestampExtractor, error) {
+	if field == "" && pattern == "" {
+		return nil, nil
+	}
+
+	extractor := &TimestampExtractor{
+		Field:    field,
+		Layouts:  []string{"rfc3339"},
+		Location: time.UTC,
+		MaxSkew:  defaultMaxSkew,
+	}
+
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp pattern: %v", err)
+		}
+		extractor.Pattern = re
+	}
+
+	// Layouts are separated by pipes, as Go layouts may contain commas,
+	// e.g. Mon, 02 Jan 2006.
+	if layouts != "" {
+		extractor.Layouts = nil
+		for _, layout := range strings.Split(layouts, "|") {
+			if layout = strings.TrimSpace(layout); layout != "" {
+				extractor.Layouts = append(extractor.Layouts, layout)
+			}
+		}
+	}
+
+	if zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp time zone: %v", err)
+		}
+		extractor.Location = location
+	}
+
+	if skew != "" {
+		d, err := time.ParseDuration(skew)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp skew: %v", err)
+		}
+		extractor.MaxSkew = d
+	}
+
+	return extractor, nil
+}
+
+// Extract sets the event time of a log when a plausible timestamp is found.
+// Otherwise, the log keeps the time Docker read the line.
+func (e *TimestampExtractor) Extract(msg *LogMessage) {
+	value, ok := e.value(msg.Data)
+	if !ok {
+		return
+	}
+
+	t, ok := e.parse(value)
+	if !ok {
+		return
+	}
+
+	skew := t.Sub(msg.Time)
+	if skew > maxFutureSkew || e.MaxSkew > 0 && (skew > e.MaxSkew || skew < -e.MaxSkew) {
+		return
+	}
+
+	msg.EventTime = t
+}
+
+func (e *TimestampExtractor) value(data string) (string, bool) {
+	if e.Field != "" {
+		object := map[string]interface{}{}
+		decoder := json.NewDecoder(strings.NewReader(data))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&object); err == nil {
+			if value, ok := object[e.Field]; ok && value != nil {
+				return fmt.Sprint(value), true
+			}
+		}
+	}
+
+	if e.Pattern != nil {
+		if match := e.Pattern.FindStringSubmatch(data); len(match) > 1 {
+			return match[1], true
+		}
+	}
+
+	return "", false
+}
+
+func (e *TimestampExtractor) parse(value string) (time.Time, bool) {
+	for _, layout := range e.Layouts {
+		var t time.Time
+		var err error
+
+		switch layout {
+		case "rfc3339":
+			t, err = time.Parse(time.RFC3339Nano, value)
+		case "epoch":
+			t, err = parseEpoch(value, time.Second)
+		case "epoch_millis":
+			t, err = parseEpoch(value, time.Millisecond)
+		default:
+			t, err = time.ParseInLocation(layout, value, e.Location)
+		}
+
+		if err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func parseEpoch(value string, unit time.Duration) (time.Time, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, int64(n*float64(unit))), nil
+}
@@ -0,0 +1,103 @@
+package cloudwatch
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	. "gopkg.in/check.v1"
+)
+
+type TimestampSuite struct {
+	now time.Time
+}
+
+var _ = Suite(&TimestampSuite{})
+
+func (s *TimestampSuite) SetUpTest(c *C) {
+	s.now = time.Date(2016, 5, 5, 12, 0, 0, 0, time.UTC)
+}
+
+func (s *TimestampSuite) extract(e *TimestampExtractor, data string) *LogMessage {
+	msg := &LogMessage{Message: &router.Message{Data: data, Time: s.now}}
+	e.Extract(msg)
+	return msg
+}
+
+func (s *TimestampSuite) TestNoExtractorWithoutFieldOrPattern(c *C) {
+	extractor, err := NewTimestampExtractor("", "", "", "", "")
+
+	c.Assert(err, IsNil)
+	c.Assert(extractor, IsNil)
+}
+
+func (s *TimestampSuite) TestExtractsRFC3339FromField(c *C) {
+	extractor, _ := NewTimestampExtractor("time", "", "", "", "")
+	msg := s.extract(extractor, `{"time":"2016-05-05T11:59:00.5Z"}`)
+
+	c.Assert(msg.EventTime.Equal(s.now.Add(-59500*time.Millisecond)), Equals, true)
+}
+
+func (s *TimestampSuite) TestExtractsEpochMillisFromField(c *C) {
+	extractor, _ := NewTimestampExtractor("ts", "", "epoch_millis", "", "")
+	msg := s.extract(extractor, `{"ts":1462449540000}`)
+
+	c.Assert(msg.EventTime.Equal(s.now.Add(-time.Minute)), Equals, true)
+}
+
+func (s *TimestampSuite) TestExtractsCustomLayoutFromPattern(c *C) {
+	extractor, _ := NewTimestampExtractor("", `^\[([^\]]+)\]`, "02/Jan/2006:15:04:05", "America/Chicago", "")
+	msg := s.extract(extractor, "[05/May/2016:06:59:00] GET /")
+
+	c.Assert(msg.EventTime.Equal(s.now.Add(-time.Minute)), Equals, true)
+}
+
+func (s *TimestampSuite) TestTriesLayoutsInOrder(c *C) {
+	extractor := &TimestampExtractor{Field: "time", Layouts: []string{"epoch", "rfc3339"}, Location: time.UTC}
+	msg := s.extract(extractor, `{"time":"2016-05-05T11:59:00Z"}`)
+
+	c.Assert(msg.EventTime.Equal(s.now.Add(-time.Minute)), Equals, true)
+}
+
+func (s *TimestampSuite) TestFallsBackWhenImplausible(c *C) {
+	extractor, _ := NewTimestampExtractor("time", "", "", "", "1h")
+	msg := s.extract(extractor, `{"time":"2015-05-05T12:00:00Z"}`)
+
+	c.Assert(msg.EventTime.IsZero(), Equals, true)
+	c.Assert(msg.Timestamp(), Equals, s.now.UnixNano()/int64(time.Millisecond))
+}
+
+func (s *TimestampSuite) TestFallsBackWhenTooFarInTheFuture(c *C) {
+	extractor, _ := NewTimestampExtractor("time", "", "", "", "")
+
+	msg := s.extract(extractor, `{"time":"2016-05-05T14:30:00Z"}`)
+	c.Assert(msg.EventTime.IsZero(), Equals, true)
+
+	msg = s.extract(extractor, `{"time":"2016-05-05T13:30:00Z"}`)
+	c.Assert(msg.EventTime, Equals, time.Date(2016, 5, 5, 13, 30, 0, 0, time.UTC))
+}
+
+func (s *TimestampSuite) TestFallsBackWhenUnparseable(c *C) {
+	extractor := &TimestampExtractor{Pattern: regexp.MustCompile(`at (\S+)`), Layouts: []string{"rfc3339"}}
+	msg := s.extract(extractor, "at noon")
+
+	c.Assert(msg.EventTime.IsZero(), Equals, true)
+}
+
+func (s *TimestampSuite) TestRejectsInvalidTimeZone(c *C) {
+	_, err := NewTimestampExtractor("time", "", "", "Nowhere/Invalid", "")
+
+	c.Assert(err, NotNil)
+}
+
+func (s *TimestampSuite) TestParsesLayoutsContainingCommas(c *C) {
+	extractor, err := NewTimestampExtractor("time", "", "epoch | Mon, 02 Jan 2006 15:04:05 MST", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(extractor.Layouts, DeepEquals, []string{"epoch", "Mon, 02 Jan 2006 15:04:05 MST"})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	msg := &LogMessage{Message: &router.Message{Data: `{"time":"` + now.Format(time.RFC1123) + `"}`, Time: now}}
+	extractor.Extract(msg)
+
+	c.Assert(msg.EventTime.Equal(now), Equals, true)
+}
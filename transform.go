@@ -2,14 +2,19 @@ package cloudwatch
 
 import "github.com/gliderlabs/logspout/router"
 
-func transform(messages <-chan *router.Message) <-chan Log {
+// transform converts messages to logs and passes them through steps in the
+// same goroutine.
+func transform(messages <-chan *router.Message, steps ...step) <-chan Log {
 	logs := make(chan Log)
+	steps = compact(steps)
 
 	go func() {
 		defer close(logs)
 
 		for msg := range messages {
-			logs <- transformMessage(msg)
+			if l := run(transformMessage(msg), steps); l != nil {
+				logs <- l
+			}
 		}
 	}()
 
@@ -17,5 +22,25 @@ func transform(messages <-chan *router.Message) <-chan Log {
 }
 
 func transformMessage(msg *router.Message) Log {
-	return &LogMessage{msg}
+	return &LogMessage{Message: msg}
+}
+
+// structure sends every log as a JSON object that includes the source the
+// log was written to.
+func structure(in <-chan Log, enabled bool) <-chan Log {
+	return pipe(in, structureStep(enabled))
+}
+
+func structureStep(enabled bool) step {
+	if !enabled {
+		return nil
+	}
+
+	return func(l Log) Log {
+		if msg, ok := l.(*LogMessage); ok {
+			msg.SetField("source", msg.Source)
+		}
+
+		return l
+	}
 }
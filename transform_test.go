@@ -24,3 +24,31 @@ func (s *TransformSuite) TestTransformsMessageToLog(c *C) {
 
 	c.Assert(log.Body(), Equals, "hello world")
 }
+
+func (s *TransformSuite) TestStructuresMessages(c *C) {
+	input := make(chan Log, 1)
+	output := structure(input, true)
+
+	input <- &LogMessage{Message: &router.Message{Data: "hello world", Source: "stderr"}}
+	log := <-output
+
+	c.Assert(log.Body(), Equals, `{"message":"hello world","source":"stderr"}`)
+}
+
+func BenchmarkTransform(b *testing.B) {
+	messages := make(chan *router.Message)
+	logs := transform(messages)
+	msg := &router.Message{Data: "GET /health 200 1.2ms"}
+
+	b.ReportAllocs()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			messages <- msg
+		}
+		close(messages)
+	}()
+
+	for range logs {
+	}
+}